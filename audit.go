@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+)
+
+// auditReport lists rules that are probably no longer needed.
+type auditReport struct {
+	// rules that apply to no extracted link
+	Unused []*Rule
+	// rules from included files that apply to no extracted link; other repositories may need them, so they are
+	// listed without failing the audit
+	UnusedIncluded []*Rule
+	// url rules whose URL succeeded under the default criterion in all attempts
+	Stale    []*Rule
+	Attempts int
+	// inline suppressions that suppress no link, e.g. `README.md:3: ignore-line "paywalled"`
+	UnusedSuppressions []string
+	// results of checking considered_alternatives; nil if they were not checked
+	Alternatives []alternativeResult
+}
+
+// alternativeResult is the result of checking one of a rule's considered_alternatives.
+type alternativeResult struct {
+	Rule *Rule
+	URL  string
+	// nil if the alternative is alive
+	Err error
+}
+
+// findUnusedRules returns the rules in config, including nested configurations, that apply to none of entries.
+// A rule that matches a URL but is shadowed by a rule of higher precedence, or is out of scope, does not apply to it.
+// Rules disabled by expiry are not reported, since they are already warned about.
+// Unused rules from included files are returned separately in unusedIncluded, since they cannot be removed here.
+func findUnusedRules(entries []linkEntry, config *Config) (unused []*Rule, unusedIncluded []*Rule) {
+	// Effective configurations have copies of rules, so rules are identified by their origins.
+	used := map[string]struct{}{}
+	for _, entry := range entries {
+		if rule := matchRule(entry.URL, entry.File, config.forFile(entry.File).rules); rule != nil {
+			used[rule.origin] = struct{}{}
+		}
+	}
+	unused, unusedIncluded = []*Rule{}, []*Rule{}
+	for _, rule := range config.allRules() {
+		if _, ok := used[rule.origin]; ok || rule.disabled {
+			continue
+		}
+		if rule.included {
+			unusedIncluded = append(unusedIncluded, rule)
+		} else {
+			unused = append(unused, rule)
+		}
+	}
+	return unused, unusedIncluded
+}
+
+// findStaleRules returns the url rules (including [[ignores]]) whose URL returns 2xx to a plain HEAD request
+// in every one of attempts attempts, i.e. the URL would pass without the rule.
+// Rules in skip, e.g. unused ones, are not checked.
+func findStaleRules(config *Config, skip []*Rule, attempts int, httpAccess HttpAccessor) []*Rule {
+	stale := []*Rule{}
+	for _, rule := range config.allRules() {
+		if rule.URL == "" || rule.disabled || slices.Contains(skip, rule) {
+			continue
+		}
+		succeeded := 0
+		for ; succeeded < attempts; succeeded++ {
+			statusCode, err := httpAccess((*Rule)(nil).request(rule.URL))
+			if err != nil || statusCode/100 != 2 {
+				break
+			}
+		}
+		if succeeded == attempts {
+			stale = append(stale, rule)
+		}
+	}
+	return stale
+}
+
+// findUnusedSuppressions returns the inline suppressions in paths that suppress no link.
+func findUnusedSuppressions(paths []string, readFile FileReader) ([]string, error) {
+	unused := []string{}
+	for _, path := range paths {
+		content, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		suppressions, errs := parseSuppressions(path, content)
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+		for _, link := range extractLinks(content) {
+			suppressionAt(link.Line, suppressions)
+		}
+		for _, s := range suppressions {
+			if !s.used {
+				unused = append(unused, fmt.Sprintf("%s:%d: %s %q", path, s.Line, s.Kind, s.Reason))
+			}
+		}
+	}
+	return unused, nil
+}
+
+// checkAlternatives checks each considered alternative in config's rules that is a URL with checkURLLiveness
+// under the default criterion. Other alternatives (e.g. "none" or a description) are not checked.
+func checkAlternatives(ctx context.Context, config *Config, httpAccess HttpAccessor) []alternativeResult {
+	results := []alternativeResult{}
+	errs := map[string]error{}
+	for _, rule := range config.allRules() {
+		if rule.disabled {
+			continue
+		}
+		for _, alternative := range rule.ConsideredAlternatives {
+			url := httpsRegex.FindString(alternative)
+			if url == "" {
+				url = httpRegex.FindString(alternative)
+			}
+			if url == "" {
+				continue
+			}
+			err, ok := errs[url]
+			if !ok {
+				// seen is per alternative because checkURLLiveness returns nil for URLs already seen;
+				// at least one attempt is made even if retry_count is omitted
+				err = checkURLLiveness(ctx, url, max(config.RetryCount, 1), nil, newSeenURLs(), httpAccess)
+				errs[url] = err
+			}
+			results = append(results, alternativeResult{Rule: rule, URL: url, Err: err})
+		}
+	}
+	return results
+}
+
+// auditRules collects the links in paths and audits config's rules against them.
+func auditRules(paths []string, config *Config, attempts int, readFile FileReader, httpAccess HttpAccessor) (*auditReport, error) {
+	entries, err := listLinks(paths, config, readFile)
+	if err != nil {
+		return nil, err
+	}
+	report := &auditReport{Attempts: attempts}
+	report.Unused, report.UnusedIncluded = findUnusedRules(entries, config)
+	if report.UnusedSuppressions, err = findUnusedSuppressions(paths, readFile); err != nil {
+		return nil, err
+	}
+	report.Stale = findStaleRules(config, slices.Concat(report.Unused, report.UnusedIncluded), attempts, httpAccess)
+	return report, nil
+}
+
+// writeAuditReport writes report to w, suggesting the removal of each rule listed.
+func writeAuditReport(w io.Writer, report *auditReport) {
+	fmt.Fprintf(w, "unused rules (applying to no link):\n")
+	if len(report.Unused) == 0 {
+		fmt.Fprintf(w, "  (none)\n")
+	}
+	for _, rule := range report.Unused {
+		fmt.Fprintf(w, "  %s %s: consider removing it, reason = %s\n", rule.origin, rule.matcherString(), rule.Reason)
+	}
+	if len(report.UnusedIncluded) > 0 {
+		fmt.Fprintf(w, "unused rules from included files (other repositories may need them):\n")
+		for _, rule := range report.UnusedIncluded {
+			fmt.Fprintf(w, "  %s %s: reason = %s\n", rule.origin, rule.matcherString(), rule.Reason)
+		}
+	}
+	fmt.Fprintf(w, "stale rules (the URL returned 2xx to HEAD in all %d attempts):\n", report.Attempts)
+	if len(report.Stale) == 0 {
+		fmt.Fprintf(w, "  (none)\n")
+	}
+	for _, rule := range report.Stale {
+		fmt.Fprintf(w, "  %s %s: consider removing it, reason = %s\n", rule.origin, rule.matcherString(), rule.Reason)
+	}
+	fmt.Fprintf(w, "unused suppressions (suppressing no link):\n")
+	if len(report.UnusedSuppressions) == 0 {
+		fmt.Fprintf(w, "  (none)\n")
+	}
+	for _, location := range report.UnusedSuppressions {
+		fmt.Fprintf(w, "  %s: consider removing it\n", location)
+	}
+	if report.Alternatives == nil {
+		return
+	}
+	fmt.Fprintf(w, "healthy alternatives (consider replacing the link with them):\n")
+	writeAlternatives(w, report.Alternatives, true)
+	fmt.Fprintf(w, "dead alternatives (consider updating considered_alternatives):\n")
+	writeAlternatives(w, report.Alternatives, false)
+}
+
+// writeAlternatives writes the alternatives in results that are alive (or dead, if alive is false).
+func writeAlternatives(w io.Writer, results []alternativeResult, alive bool) {
+	written := 0
+	for _, result := range results {
+		if (result.Err == nil) != alive {
+			continue
+		}
+		written++
+		if alive {
+			fmt.Fprintf(w, "  %s %s: %s\n", result.Rule.origin, result.Rule.matcherString(), result.URL)
+		} else {
+			fmt.Fprintf(w, "  %s %s: %s: %v\n", result.Rule.origin, result.Rule.matcherString(), result.URL, result.Err)
+		}
+	}
+	if written == 0 {
+		fmt.Fprintf(w, "  (none)\n")
+	}
+}
+
+// hasDeadAlternatives reports whether any alternative in report is dead.
+func (a *auditReport) hasDeadAlternatives() bool {
+	for _, result := range a.Alternatives {
+		if result.Err != nil {
+			return true
+		}
+	}
+	return false
+}
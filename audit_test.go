@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAuditRules(t *testing.T) {
+	config := &Config{
+		TextFileExtensions: []string{".md"},
+		Ignores: []Ignore{
+			{URL: "https://example.com/fixed", Codes: []int{404}, Reason: "was 404", ConsideredAlternatives: []string{"none"}},
+			{URL: "https://example.com/flaky", Codes: []int{200, 503}, Reason: "flaky", ConsideredAlternatives: []string{"none"}},
+			{URL: "https://example.com/removed", Codes: []int{404}, Reason: "removed from docs", ConsideredAlternatives: []string{"none"}},
+		},
+		PrefixIgnores: []PrefixIgnore{
+			{Prefix: "https://x.com/", Reason: "X.com links are ignored"},
+			// shadowed by prefix_ignores[0]
+			{Prefix: "https://x.com/user", Reason: "never applies"},
+		},
+		included: []*Config{{
+			PrefixIgnores: []PrefixIgnore{{Prefix: "https://internal.example.org/", Reason: "shared among repositories"}},
+			rulePrefix:    "shared/org.toml:",
+			fromInclude:   true,
+		}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	readFile := getReadFileMock([]readFileEntry{
+		{"README.md", "https://example.com/fixed\nhttps://example.com/flaky\nhttps://x.com/user1\n"},
+	})
+	calls := 0
+	var httpAccess HttpAccessor = func(req HttpRequest) (int, error) {
+		calls++
+		if req.Method != "HEAD" {
+			t.Errorf("method = %s, want HEAD", req.Method)
+		}
+		if req.URL == "https://example.com/flaky" && calls%2 == 0 {
+			return 503, nil
+		}
+		return 200, nil
+	}
+	report, err := auditRules([]string{"README.md"}, config, 3, readFile, httpAccess)
+	if err != nil {
+		t.Fatalf("auditRules() error = %v, want nil", err)
+	}
+	names := func(rules []*Rule) []string {
+		result := []string{}
+		for _, rule := range rules {
+			result = append(result, rule.name())
+		}
+		return result
+	}
+	if got, want := names(report.Unused), []string{"prefix_ignores[1]", "ignores[2]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Unused = %v, want %v", got, want)
+	}
+	if got, want := names(report.UnusedIncluded), []string{"shared/org.toml:prefix_ignores[0]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("UnusedIncluded = %v, want %v", got, want)
+	}
+	if got, want := names(report.Stale), []string{"ignores[0]"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Stale = %v, want %v", got, want)
+	}
+
+	var b strings.Builder
+	writeAuditReport(&b, report)
+	for _, want := range []string{
+		`  prefix_ignores[1] prefix = "https://x.com/user": consider removing it, reason = never applies`,
+		"unused rules from included files (other repositories may need them):\n" +
+			`  shared/org.toml:prefix_ignores[0] prefix = "https://internal.example.org/": reason = shared among repositories`,
+		"stale rules (the URL returned 2xx to HEAD in all 3 attempts):\n" +
+			`  ignores[0] url = "https://example.com/fixed": consider removing it, reason = was 404`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("writeAuditReport() = %q, want to contain %q", b.String(), want)
+		}
+	}
+}
+
+func TestCheckAlternatives(t *testing.T) {
+	config := &Config{
+		TextFileExtensions: []string{".md"},
+		Ignores: []Ignore{
+			{URL: "https://example.com/a", Codes: []int{404}, Reason: "a", ConsideredAlternatives: []string{
+				"https://mirror.example.com/a # a mirror",
+				"none",
+			}},
+			{URL: "https://example.com/b", Codes: []int{404}, Reason: "b", ConsideredAlternatives: []string{
+				"https://mirror.example.com/a",
+				"https://archive.example.com/b",
+			}},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	accessed := []string{}
+	var httpAccess HttpAccessor = func(req HttpRequest) (int, error) {
+		accessed = append(accessed, req.URL)
+		if req.URL == "https://mirror.example.com/a" {
+			return 200, nil
+		}
+		return 404, nil
+	}
+	// retry_count is omitted, but each URL is still requested
+	results := checkAlternatives(context.Background(), config, httpAccess)
+	// Rules are in order of precedence, and each URL is requested once
+	if want := []string{"https://mirror.example.com/a", "https://archive.example.com/b"}; !reflect.DeepEqual(accessed, want) {
+		t.Errorf("accessed = %v, want %v", accessed, want)
+	}
+	report := &auditReport{Attempts: 1, Alternatives: results}
+	if !report.hasDeadAlternatives() {
+		t.Error("hasDeadAlternatives() = false, want true")
+	}
+	var b strings.Builder
+	writeAuditReport(&b, report)
+	for _, want := range []string{
+		"healthy alternatives (consider replacing the link with them):\n" +
+			`  ignores[1] url = "https://example.com/b": https://mirror.example.com/a` + "\n" +
+			`  ignores[0] url = "https://example.com/a": https://mirror.example.com/a` + "\n",
+		"dead alternatives (consider updating considered_alternatives):\n" +
+			`  ignores[1] url = "https://example.com/b": https://archive.example.com/b: invalid status code: 404` + "\n",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("writeAuditReport() = %q, want to contain %q", b.String(), want)
+		}
+	}
+}
@@ -0,0 +1,952 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"runtime/debug"
+	"slices"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// Set by -ldflags "-X main.version=... -X main.revision=..." (see Makefile)
+var (
+	version  = "dev"
+	revision = ""
+)
+
+// globalOptions are accepted both before the command and among the command's own flags.
+type globalOptions struct {
+	configPath string
+	lockPath   string
+}
+
+func (o *globalOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.configPath, "config", o.configPath, "path to the configuration file")
+	fs.StringVar(&o.lockPath, "lock", o.lockPath, "path to the lock file")
+}
+
+// stringsFlag is a flag that may be given more than once.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ", ")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+type command struct {
+	name    string
+	summary string
+	run     func(ctx context.Context, opts *globalOptions, args []string) int
+}
+
+var commands []command
+
+func init() {
+	// Initialized here because runHelp refers to commands.
+	commands = []command{
+		{"check", "check that all links are alive (default)", runCheck},
+		{"add", "add URLs to the lock file (same as lock add)", runLockAdd},
+		{"lock", "manage the lock file (add, verify, list, update, remove, prune)", runLock},
+		{"config", "inspect the configuration (validate, show, audit)", runConfig},
+		{"explain", "explain which rules apply to a URL, without network access", runExplain},
+		{"list", "list all links and the rules that apply, without network access", runList},
+		{"init", "write an initial configuration file for this repository", runInit},
+		{"triage", "turn failures into config entries interactively", runTriage},
+		{"version", "print version information", runVersion},
+		{"help", "print this help", runHelp},
+	}
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: link-checker [--config path] [--lock path] [command] [arguments]\n\n")
+	fmt.Fprintf(w, "Commands:\n")
+	for _, c := range commands {
+		fmt.Fprintf(w, "  %-8s  %s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(w, "\nGlobal flags:\n")
+	fs := flag.NewFlagSet("link-checker", flag.ContinueOnError)
+	(&globalOptions{configPath: defaultConfigFilePath, lockPath: defaultLockFilePath}).register(fs)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+	fmt.Fprintf(w, "\nRun 'link-checker <command> --help' for the command's flags.\n")
+}
+
+// run runs the command line args (without the program name) and returns the exit code.
+func run(args []string) int {
+	// An interrupt cancels ctx, so that the checks stop; another one kills the process
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	context.AfterFunc(ctx, stop)
+
+	opts := &globalOptions{configPath: defaultConfigFilePath, lockPath: defaultLockFilePath}
+	name, before, after, explicit := splitCommand(args)
+	if !explicit {
+		for _, arg := range args {
+			if arg == "-h" || arg == "-help" || arg == "--help" {
+				usage(os.Stdout)
+				return exitOK
+			}
+		}
+		// Flags are parsed by the check command, together with its own flags
+		after = args
+	} else if name == "check" {
+		// Flags before the command may be flags of check too
+		after = append(slices.Clone(before), after...)
+	} else {
+		fs := flag.NewFlagSet("link-checker", flag.ContinueOnError)
+		opts.register(fs)
+		fs.Usage = func() { usage(fs.Output()) }
+		if err := fs.Parse(before); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return exitOK
+			}
+			return exitUsage
+		}
+	}
+	for _, c := range commands {
+		if c.name == name {
+			return c.run(ctx, opts, after)
+		}
+	}
+	log.Printf("Error: unknown command: %s\n", name)
+	usage(os.Stderr)
+	return exitUsage
+}
+
+// splitCommand finds the command name in args, skipping global flags before it.
+// Without a command (e.g. only --dry-run is given), it defaults to check, so the flags of check are skipped too.
+func splitCommand(args []string) (name string, before []string, after []string, explicit bool) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return "check", nil, nil, false
+		case takesValue(arg):
+			// skip the value
+			i++
+		case strings.HasPrefix(arg, "-"):
+		default:
+			return arg, args[:i], args[i+1:], true
+		}
+	}
+	return "check", nil, nil, false
+}
+
+// takesValue reports whether arg is a flag of check (or a global flag) that takes a value given as the next argument.
+func takesValue(arg string) bool {
+	name := strings.TrimLeft(arg, "-")
+	if !strings.HasPrefix(arg, "-") || strings.Contains(name, "=") {
+		return false
+	}
+	fs, _, _ := newCheckFlagSet(&globalOptions{})
+	f := fs.Lookup(name)
+	if f == nil {
+		return false
+	}
+	boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !boolFlag.IsBoolFlag()
+}
+
+// newFlagSet returns a flag set for a command, with the global options registered.
+func newFlagSet(name string, synopsis string, opts *globalOptions) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	opts.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: link-checker %s\n\nFlags:\n", synopsis)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// parseFlags parses args with fs, allowing flags to appear after positional arguments.
+// ok is false if the command should exit with code.
+func parseFlags(fs *flag.FlagSet, args []string) (positional []string, code int, ok bool) {
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, exitOK, false
+			}
+			return nil, exitUsage, false
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, exitOK, true
+		}
+		if args[0] == "--" {
+			return append(positional, args[1:]...), exitOK, true
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// loadConfig reads and validates the configuration file, and the nested ones in subdirectories.
+func loadConfig(opts *globalOptions) (*Config, error) {
+	config, err := readConfig(opts.configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config %s: %w", opts.configPath, err)
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config %s: %w", opts.configPath, err)
+	}
+	// Nested configuration files are found among the files tracked by git.
+	// If they cannot be listed, commands that need the files report it.
+	if paths, err := listFiles(); err == nil {
+		if err := loadNestedConfigs(config, paths); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range append([]*Config{config}, config.nested...) {
+		for _, warning := range c.warnings {
+			log.Printf("Warning: %s: %s\n", c.path, warning)
+		}
+	}
+	return config, nil
+}
+
+// loadLockConfig reads the configuration file for lock commands, which only need its lockSettings.
+// A missing or invalid configuration file means the defaults.
+func loadLockConfig(opts *globalOptions) *Config {
+	config, err := readConfig(opts.configPath)
+	if err == nil {
+		// Also builds the rules, whose timeouts apply to lock fetches
+		err = config.Validate()
+	}
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Warning: failed to read config %s, so its settings are not used: %v\n", opts.configPath, err)
+		}
+		return &Config{}
+	}
+	return config
+}
+
+// listConfiguredTextFiles lists the files to read according to config.
+func listConfiguredTextFiles(config *Config) ([]string, []error) {
+	paths, err := listFiles()
+	if err != nil {
+		return nil, []error{err}
+	}
+	return selectTextFiles(paths, config)
+}
+
+// newCheckFlagSet returns the flag set of check.
+func newCheckFlagSet(opts *globalOptions) (fs *flag.FlagSet, dryRun *bool, jobs *int) {
+	fs = newFlagSet("check", "[check] [--dry-run] [--jobs N]", opts)
+	dryRun = fs.Bool("dry-run", false, "print the planned requests without touching the network")
+	jobs = fs.Int("jobs", defaultJobs, "number of files and lock entries checked at the same time")
+	return fs, dryRun, jobs
+}
+
+func runCheck(ctx context.Context, opts *globalOptions, args []string) int {
+	fs, dryRun, jobs := newCheckFlagSet(opts)
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		log.Printf("Error: unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return exitUsage
+	}
+
+	config, err := loadConfig(opts)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitConfigError
+	}
+
+	if *dryRun {
+		lockFile, err := readLockFile(opts.lockPath)
+		if err != nil {
+			// Lock file is optional, so just log a warning and continue
+			log.Printf("Warning: failed to read lock file: %v\n", err)
+		}
+		textFiles, errs := listConfiguredTextFiles(config)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Printf("%v\n", err)
+			}
+			return exitIOError
+		}
+		plan, err := planCheck(textFiles, config, lockFile, readFile)
+		if err != nil {
+			log.Printf("Error extracting links: %v\n", err)
+			return exitIOError
+		}
+		if err := writeCheckPlan(os.Stdout, plan); err != nil {
+			log.Printf("Error: %v\n", err)
+			return exitIOError
+		}
+		return exitOK
+	}
+
+	failures := &failures{}
+	// Lock entries and files are checked together on the pool, and failures of both are reported at the end
+	pool := newWorkerPool(*jobs)
+	defer pool.close()
+
+	// Check lock file if it exists
+	var lockResults []error
+	lockFile, err := readLockFile(opts.lockPath)
+	if err != nil {
+		// Lock file is optional, so just log a warning and continue
+		log.Printf("Warning: failed to read lock file: %v\n", err)
+	} else if len(lockFile.Locks) > 0 {
+		log.Printf("Verifying %d lock entries...\n", len(lockFile.Locks))
+		lockResults = submitLockVerifications(ctx, pool, lockFile, config.lockSettings())
+	}
+
+	textFiles, errs := listConfiguredTextFiles(config)
+	for _, err := range errs {
+		failures.add(failureIO, err)
+	}
+
+	seen := newSeenURLs()
+	fileResults := make([]error, len(textFiles))
+	for i, path := range textFiles {
+		fileConfig := config.forFile(path)
+		pool.submit(func() {
+			fileResults[i] = checkFile(ctx, path, fileConfig.RetryCount, fileConfig.rules, seen, readFile, sendHttpRequest)
+		})
+	}
+	pool.wait()
+
+	var lockErrors []error
+	for _, err := range lockResults {
+		if err != nil {
+			lockErrors = append(lockErrors, err)
+		}
+	}
+	if len(lockErrors) > 0 {
+		log.Printf("Lock file verification failed with %d errors:\n", len(lockErrors))
+		failures.addLockErrors(lockErrors)
+	} else if len(lockResults) > 0 {
+		log.Printf("All lock entries verified successfully\n")
+	}
+	for _, err := range fileResults {
+		if err != nil {
+			failures.addLinkErrors(err)
+		}
+	}
+	warnUnusedRules(textFiles, config)
+	exitCode := failures.exitCode()
+	if exitCode != exitOK {
+		log.Printf("Failed: %v (exit code %d)\n", failures, exitCode)
+	}
+	return exitCode
+}
+
+// warnUnusedRules logs a warning for each rule that applies to no link in paths.
+func warnUnusedRules(paths []string, config *Config) {
+	entries, err := listLinks(paths, config, readFile)
+	if err != nil {
+		// already reported by checkFile
+		return
+	}
+	// Rules from included files may be needed by other repositories
+	unused, _ := findUnusedRules(entries, config)
+	for _, rule := range unused {
+		log.Printf("Warning: %s (%s) applies to no link; consider removing it (see link-checker config audit)\n", rule.origin, rule.matcherString())
+	}
+}
+
+func runInit(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("init", "init [--force] [--no-check]", opts)
+	force := fs.Bool("force", false, "overwrite the configuration file if it exists")
+	noCheck := fs.Bool("no-check", false, "do not check links, so that no [[ignores]] stubs are written")
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		log.Printf("Error: unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return exitUsage
+	}
+	paths, err := listFiles()
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitIOError
+	}
+	if err := initConfigFile(ctx, opts.configPath, opts.lockPath, paths, *noCheck, *force); err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitFailure
+	}
+	log.Printf("Wrote %s; review the TODOs in it\n", opts.configPath)
+	return exitOK
+}
+
+func runTriage(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("triage", "triage", opts)
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		log.Printf("Error: unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return exitUsage
+	}
+	config, err := loadConfig(opts)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitConfigError
+	}
+	textFiles, errs := listConfiguredTextFiles(config)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("%v\n", err)
+		}
+		return exitIOError
+	}
+	var linkErrors []*linkError
+	seen := newSeenURLs()
+	for _, path := range textFiles {
+		fileConfig := config.forFile(path)
+		found, others := splitLinkErrors(checkFile(ctx, path, fileConfig.RetryCount, fileConfig.rules, seen, readFile, sendHttpRequest))
+		if len(others) > 0 {
+			log.Printf("Error: %v\n", errors.Join(others...))
+			return exitIOError
+		}
+		linkErrors = append(linkErrors, found...)
+	}
+	if len(linkErrors) == 0 {
+		log.Printf("No failures to triage\n")
+		return exitOK
+	}
+	entries, err := listLinks(textFiles, config, readFile)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitIOError
+	}
+	decisions, err := triage(os.Stdin, os.Stdout, collectTriageItems(linkErrors, entries))
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitIOError
+	}
+
+	var b strings.Builder
+	writeTriageDecisions(&b, decisions)
+	if b.Len() > 0 {
+		if err := appendToConfigFile(opts.configPath, b.String()); err != nil {
+			log.Printf("Error: %v\n", err)
+			return exitConfigError
+		}
+		log.Printf("Updated %s\n", opts.configPath)
+	}
+	return exitOK
+}
+
+func runLock(ctx context.Context, opts *globalOptions, args []string) int {
+	if len(args) == 0 {
+		log.Printf("Error: lock subcommand is required\n")
+		log.Printf("Usage: link-checker lock add|verify|list|update|remove|prune [arguments]\n")
+		return exitUsage
+	}
+	switch args[0] {
+	case "add":
+		return runLockAdd(ctx, opts, args[1:])
+	case "verify":
+		return runLockVerify(ctx, opts, args[1:])
+	case "list":
+		return runLockList(ctx, opts, args[1:])
+	case "update":
+		return runLockUpdate(ctx, opts, args[1:])
+	case "remove":
+		return runLockRemove(ctx, opts, args[1:])
+	case "prune":
+		return runLockPrune(ctx, opts, args[1:])
+	default:
+		log.Printf("Error: unknown lock subcommand: %s\n", args[0])
+		log.Printf("Usage: link-checker lock add|verify|list|update|remove|prune [arguments]\n")
+		return exitUsage
+	}
+}
+
+func runLockAdd(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("add", "lock add [--force | --append] [--hash-version h1|h2] [--algo sha256|sha384|sha512] [--selector selector] "+
+		"[--text-between start --text-between end] [--exclude-regex regex]... [--exclude-selector selector]... <URL>...", opts)
+	force := false
+	fs.BoolVar(&force, "force", false, "update the entry if the URL is already locked")
+	fs.BoolVar(&force, "f", false, "shorthand for --force")
+	appendHash := fs.Bool("append", false, "add the hash of the current content to the accepted hashes of the locked URL, keeping the others")
+	hashVersion := fs.String("hash-version", "", fmt.Sprintf("hash version (%s); h2 if any of the flags below is given, h1 otherwise", strings.Join(hashVersions, ", ")))
+	algorithm := fs.String("algo", "", "hash algorithm (sha256, sha384, sha512); sha384 is stored as hash_of_content, and the others in hashes "+
+		"(default: sha384, or with --append, the algorithm of the entry)")
+	selector := fs.String("selector", "", "with h2, a CSS selector or an XPath starting with / selecting the elements to hash")
+	var textBetween, excludeRegexes, excludeSelectors stringsFlag
+	fs.Var(&textBetween, "text-between", "with h2, given twice: hash only the text between these start and end markers")
+	fs.Var(&excludeRegexes, "exclude-regex", "with h2, a regular expression whose matches are left out of the hash (repeatable)")
+	fs.Var(&excludeSelectors, "exclude-selector", "with h2, a CSS selector whose elements are left out of the hash (repeatable)")
+	urls, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(urls) == 0 {
+		log.Printf("Error: URL argument is required\n")
+		fs.Usage()
+		return exitUsage
+	}
+	settings := loadLockConfig(opts).lockSettings()
+	if *appendHash {
+		if force || *hashVersion != "" || *selector != "" || len(textBetween) > 0 || len(excludeRegexes) > 0 || len(excludeSelectors) > 0 {
+			log.Printf("Error: --append uses the settings of the entry, so only --algo can be given with it\n")
+			fs.Usage()
+			return exitUsage
+		}
+		return appendLockHashes(ctx, opts, urls, *algorithm, settings)
+	}
+	hasError := false
+	for _, url := range urls {
+		lock := Lock{
+			URI:              url,
+			HashVersion:      *hashVersion,
+			ExcludeRegexes:   excludeRegexes,
+			ExcludeSelectors: excludeSelectors,
+			Selector:         *selector,
+			TextBetween:      textBetween,
+		}
+		if lock.HashVersion == "" && lock.normalizes() {
+			lock.HashVersion = "h2"
+		}
+		if err := addLockEntry(ctx, opts.lockPath, lock, *algorithm, force, settings); err != nil {
+			log.Printf("Error adding lock entry: %v\n", err)
+			hasError = true
+		} else {
+			log.Printf("Successfully added %s to lock file\n", url)
+		}
+	}
+	if hasError {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// appendLockHashes adds the hashes of the current content of urls to their entries for lock add --append.
+func appendLockHashes(ctx context.Context, opts *globalOptions, urls []string, algorithm string, settings lockSettings) int {
+	unlock, err := lockLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to lock the lock file: %v\n", err)
+		return exitIOError
+	}
+	defer unlock()
+	lockFile, err := readLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to read lock file: %v\n", err)
+		return exitConfigError
+	}
+	hasError := false
+	for _, url := range urls {
+		added, err := appendLockHash(ctx, lockFile, url, algorithm, settings)
+		switch {
+		case err != nil:
+			log.Printf("Error adding a hash: %v\n", err)
+			hasError = true
+		case added:
+			log.Printf("Added a hash of the current content of %s\n", url)
+		default:
+			log.Printf("The current content of %s already matches an accepted hash\n", url)
+		}
+	}
+	if err := writeLockFile(opts.lockPath, lockFile); err != nil {
+		log.Printf("Error: failed to write lock file: %v\n", err)
+		return exitIOError
+	}
+	if hasError {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runLockVerify(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("verify", "lock verify [--jobs N]", opts)
+	jobs := fs.Int("jobs", defaultJobs, "number of lock entries verified at the same time")
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		log.Printf("Error: unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return exitUsage
+	}
+	lockFile, err := readLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to read lock file: %v\n", err)
+		return exitConfigError
+	}
+	config := loadLockConfig(opts)
+	pool := newWorkerPool(*jobs)
+	defer pool.close()
+	lockErrors := verifyLockFile(ctx, pool, lockFile, config.lockSettings())
+	if len(lockErrors) > 0 {
+		log.Printf("Lock file verification failed with %d errors:\n", len(lockErrors))
+		failures := &failures{}
+		failures.addLockErrors(lockErrors)
+		return failures.exitCode()
+	}
+	log.Printf("All %d lock entries verified successfully\n", len(lockFile.Locks))
+	return exitOK
+}
+
+// findLockReferences returns the files linking to each URL, among the files checked according to the configuration.
+// If it fails, it logs the error and returns the exit code.
+func findLockReferences(opts *globalOptions) (map[string][]string, int) {
+	config, err := loadConfig(opts)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return nil, exitConfigError
+	}
+	textFiles, errs := listConfiguredTextFiles(config)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("%v\n", err)
+		}
+		return nil, exitIOError
+	}
+	entries, err := listLinks(textFiles, config, readFile)
+	if err != nil {
+		log.Printf("Error extracting links: %v\n", err)
+		return nil, exitIOError
+	}
+	return lockReferences(entries), exitOK
+}
+
+func runLockList(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("list", "lock list", opts)
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		log.Printf("Error: unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return exitUsage
+	}
+	lockFile, err := readLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to read lock file: %v\n", err)
+		return exitConfigError
+	}
+	references, code := findLockReferences(opts)
+	if code != exitOK {
+		return code
+	}
+	if err := writeLockList(os.Stdout, lockFile, references); err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitIOError
+	}
+	return exitOK
+}
+
+func runLockUpdate(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("update", "lock update --all | <URL>...", opts)
+	all := fs.Bool("all", false, "update all entries")
+	urls, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if *all == (len(urls) > 0) {
+		log.Printf("Error: either --all or URL arguments are required\n")
+		fs.Usage()
+		return exitUsage
+	}
+	unlock, err := lockLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to lock the lock file: %v\n", err)
+		return exitIOError
+	}
+	defer unlock()
+	lockFile, err := readLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to read lock file: %v\n", err)
+		return exitConfigError
+	}
+	changes, err := updateLockEntries(ctx, lockFile, urls, loadLockConfig(opts).lockSettings())
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitFailure
+	}
+	hasError := false
+	for _, change := range changes {
+		fmt.Println(change)
+		if change.Err != nil {
+			hasError = true
+		}
+	}
+	if err := writeLockFile(opts.lockPath, lockFile); err != nil {
+		log.Printf("Error: failed to write lock file: %v\n", err)
+		return exitIOError
+	}
+	if hasError {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func runLockRemove(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("remove", "lock remove <URL>...", opts)
+	urls, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(urls) == 0 {
+		log.Printf("Error: URL argument is required\n")
+		fs.Usage()
+		return exitUsage
+	}
+	unlock, err := lockLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to lock the lock file: %v\n", err)
+		return exitIOError
+	}
+	defer unlock()
+	lockFile, err := readLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to read lock file: %v\n", err)
+		return exitConfigError
+	}
+	if err := removeLockEntries(lockFile, urls); err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitFailure
+	}
+	if err := writeLockFile(opts.lockPath, lockFile); err != nil {
+		log.Printf("Error: failed to write lock file: %v\n", err)
+		return exitIOError
+	}
+	log.Printf("Removed %d entries from lock file\n", len(urls))
+	return exitOK
+}
+
+func runLockPrune(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("prune", "lock prune", opts)
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		log.Printf("Error: unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return exitUsage
+	}
+	unlock, err := lockLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to lock the lock file: %v\n", err)
+		return exitIOError
+	}
+	defer unlock()
+	lockFile, err := readLockFile(opts.lockPath)
+	if err != nil {
+		log.Printf("Error: failed to read lock file: %v\n", err)
+		return exitConfigError
+	}
+	references, code := findLockReferences(opts)
+	if code != exitOK {
+		return code
+	}
+	removed := pruneLockEntries(lockFile, references)
+	if len(removed) == 0 {
+		log.Printf("No entries to prune\n")
+		return exitOK
+	}
+	for _, uri := range removed {
+		fmt.Printf("removed %s\n", uri)
+	}
+	if err := writeLockFile(opts.lockPath, lockFile); err != nil {
+		log.Printf("Error: failed to write lock file: %v\n", err)
+		return exitIOError
+	}
+	return exitOK
+}
+
+func runConfig(ctx context.Context, opts *globalOptions, args []string) int {
+	if len(args) == 0 {
+		log.Printf("Error: config subcommand is required\n")
+		log.Printf("Usage: link-checker config validate|show|audit\n")
+		return exitUsage
+	}
+	fs := newFlagSet(args[0], "config "+args[0], opts)
+	var attempts *int
+	var alternatives *bool
+	if args[0] == "audit" {
+		fs = newFlagSet(args[0], "config audit [--attempts N] [--alternatives]", opts)
+		attempts = fs.Int("attempts", 3, "how many times each url rule's URL is requested to decide it is stale")
+		alternatives = fs.Bool("alternatives", false, "also check that considered_alternatives are alive")
+	}
+	positional, code, ok := parseFlags(fs, args[1:])
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		log.Printf("Error: unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return exitUsage
+	}
+	switch args[0] {
+	case "validate":
+		if _, err := loadConfig(opts); err != nil {
+			log.Printf("Error: %v\n", err)
+			return exitConfigError
+		}
+		log.Printf("%s is valid\n", opts.configPath)
+		return exitOK
+	case "show":
+		config, err := loadConfig(opts)
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+			return exitConfigError
+		}
+		if err := toml.NewEncoder(os.Stdout).Encode(config); err != nil {
+			log.Printf("Error: %v\n", err)
+			return exitIOError
+		}
+		return exitOK
+	case "audit":
+		if *attempts < 1 {
+			log.Printf("Error: --attempts must be positive\n")
+			return exitUsage
+		}
+		config, err := loadConfig(opts)
+		if err != nil {
+			log.Printf("Error: %v\n", err)
+			return exitConfigError
+		}
+		textFiles, errs := listConfiguredTextFiles(config)
+		if len(errs) > 0 {
+			for _, err := range errs {
+				log.Printf("%v\n", err)
+			}
+			return exitIOError
+		}
+		report, err := auditRules(textFiles, config, *attempts, readFile, sendHttpRequest)
+		if err != nil {
+			log.Printf("Error extracting links: %v\n", err)
+			return exitIOError
+		}
+		if *alternatives {
+			report.Alternatives = checkAlternatives(ctx, config, sendHttpRequest)
+		}
+		writeAuditReport(os.Stdout, report)
+		if len(report.Unused) > 0 || len(report.Stale) > 0 || len(report.UnusedSuppressions) > 0 || report.hasDeadAlternatives() {
+			return exitFailure
+		}
+		return exitOK
+	default:
+		log.Printf("Error: unknown config subcommand: %s\n", args[0])
+		log.Printf("Usage: link-checker config validate|show|audit\n")
+		return exitUsage
+	}
+}
+
+func runExplain(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("explain", "explain <URL> [--file path]", opts)
+	file := fs.String("file", "", "the file in which the URL is found")
+	urls, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(urls) != 1 {
+		log.Printf("Error: exactly one URL argument is required\n")
+		fs.Usage()
+		return exitUsage
+	}
+	config, err := loadConfig(opts)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitConfigError
+	}
+	explainURL(os.Stdout, urls[0], *file, config)
+	return exitOK
+}
+
+func runList(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("list", "list [--format table|csv|json]", opts)
+	format := fs.String("format", "table", "output format: table, csv or json")
+	positional, code, ok := parseFlags(fs, args)
+	if !ok {
+		return code
+	}
+	if len(positional) > 0 {
+		log.Printf("Error: unexpected arguments: %v\n", positional)
+		fs.Usage()
+		return exitUsage
+	}
+	switch *format {
+	case "table", "csv", "json":
+	default:
+		log.Printf("Error: unknown format: %s\n", *format)
+		fs.Usage()
+		return exitUsage
+	}
+	config, err := loadConfig(opts)
+	if err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitConfigError
+	}
+	textFiles, errs := listConfiguredTextFiles(config)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Printf("%v\n", err)
+		}
+		return exitIOError
+	}
+	entries, err := listLinks(textFiles, config, readFile)
+	if err != nil {
+		log.Printf("Error extracting links: %v\n", err)
+		return exitIOError
+	}
+	if err := writeLinkInventory(os.Stdout, *format, entries); err != nil {
+		log.Printf("Error: %v\n", err)
+		return exitIOError
+	}
+	return exitOK
+}
+
+// versionString returns the version set at link time, falling back to the module's build info
+// (e.g. for go install github.com/koba-e964/link-checker@latest).
+func versionString() string {
+	v, rev := version, revision
+	if info, ok := debug.ReadBuildInfo(); ok {
+		if v == "dev" && info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		}
+		if rev == "" {
+			for _, setting := range info.Settings {
+				if setting.Key == "vcs.revision" && len(setting.Value) >= 7 {
+					rev = setting.Value[:7]
+				}
+			}
+		}
+	}
+	if rev == "" {
+		return fmt.Sprintf("link-checker %s", v)
+	}
+	return fmt.Sprintf("link-checker %s (rev: %s)", v, rev)
+}
+
+func runVersion(ctx context.Context, opts *globalOptions, args []string) int {
+	fs := newFlagSet("version", "version", opts)
+	if _, code, ok := parseFlags(fs, args); !ok {
+		return code
+	}
+	fmt.Println(versionString())
+	return exitOK
+}
+
+func runHelp(ctx context.Context, opts *globalOptions, args []string) int {
+	usage(os.Stdout)
+	return exitOK
+}
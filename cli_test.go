@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitCommand(t *testing.T) {
+	tests := []struct {
+		args     []string
+		name     string
+		before   []string
+		after    []string
+		explicit bool
+	}{
+		{[]string{}, "check", nil, nil, false},
+		{[]string{"--dry-run"}, "check", nil, nil, false},
+		{[]string{"--config", "a.toml", "list", "--format", "csv"}, "list", []string{"--config", "a.toml"}, []string{"--format", "csv"}, true},
+		{[]string{"--lock=a.lock", "lock", "add", "-f", "https://example.com"}, "lock", []string{"--lock=a.lock"}, []string{"add", "-f", "https://example.com"}, true},
+		{[]string{"explain", "https://example.com", "--file", "README.md"}, "explain", []string{}, []string{"https://example.com", "--file", "README.md"}, true},
+		{[]string{"--jobs", "4", "--dry-run"}, "check", nil, nil, false},
+		{[]string{"--jobs=4", "--dry-run=false", "check"}, "check", []string{"--jobs=4", "--dry-run=false"}, []string{}, true},
+	}
+	for _, test := range tests {
+		name, before, after, explicit := splitCommand(test.args)
+		if name != test.name || !reflect.DeepEqual(before, test.before) || !reflect.DeepEqual(after, test.after) || explicit != test.explicit {
+			t.Errorf("splitCommand(%q) = (%q, %q, %q, %v), want (%q, %q, %q, %v)", test.args, name, before, after, explicit, test.name, test.before, test.after, test.explicit)
+		}
+	}
+}
+
+func TestRunCheckFlagsBeforeCommand(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.toml")
+	for _, args := range [][]string{
+		{"--dry-run", "--config", missing, "check"},
+		{"--jobs", "2", "--config", missing, "check"},
+	} {
+		// The flags are accepted, so the run fails only on the missing config
+		if code := run(args); code != exitConfigError {
+			t.Errorf("run(%q) = %d, want %d", args, code, exitConfigError)
+		}
+	}
+	if code := run([]string{"--dry-run", "list"}); code != exitUsage {
+		t.Errorf("run([--dry-run list]) = %d, want %d", code, exitUsage)
+	}
+}
+
+func TestParseFlags(t *testing.T) {
+	opts := &globalOptions{configPath: defaultConfigFilePath, lockPath: defaultLockFilePath}
+	fs := newFlagSet("explain", "explain <URL> [--file path]", opts)
+	file := fs.String("file", "", "")
+	positional, _, ok := parseFlags(fs, []string{"https://example.com", "--file", "README.md", "--config", "a.toml", "--", "-x"})
+	if !ok {
+		t.Fatal("parseFlags() ok = false, want true")
+	}
+	if !reflect.DeepEqual(positional, []string{"https://example.com", "-x"}) {
+		t.Errorf("positional = %q, want [https://example.com -x]", positional)
+	}
+	if *file != "README.md" || opts.configPath != "a.toml" || opts.lockPath != defaultLockFilePath {
+		t.Errorf("file = %q, opts = %+v", *file, opts)
+	}
+
+	fs = flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	if _, code, ok := parseFlags(fs, []string{"--unknown"}); ok || code != exitUsage {
+		t.Errorf("parseFlags() with an unknown flag = (%d, %v), want (%d, false)", code, ok, exitUsage)
+	}
+}
+
+func TestLoadLockConfig(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "check_links_config.toml")
+	if err := os.WriteFile(configPath, []byte("retry_count = 3\nmax_lock_content_length = -1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An invalid limit is not used, and neither are the other settings
+	settings := loadLockConfig(&globalOptions{configPath: configPath}).lockSettings()
+	if settings.maxContentLength != defaultMaxLockContentLength || settings.retryCount != 1 {
+		t.Errorf("lockSettings() = %+v, want the defaults", settings)
+	}
+}
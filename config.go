@@ -1,14 +1,15 @@
 package main
 
 import (
-	"crypto/sha512"
-	"encoding/hex"
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
+	"path/filepath"
+	"regexp"
 	"slices"
 	"strings"
 	"time"
@@ -16,27 +17,89 @@ import (
 	"github.com/BurntSushi/toml"
 )
 
-const configFilePath = "./check_links_config.toml"
-const lockFilePath = "./check_links.lock"
+const defaultConfigFilePath = "./check_links_config.toml"
+const defaultLockFilePath = "./check_links.lock"
+
+// Default of max_lock_content_length
+const defaultMaxLockContentLength = 100 * 1024 * 1024
 
 type Config struct {
-	RetryCount int `toml:"retry_count"`
+	// Other configuration files to merge, relative to this file; this file takes precedence over them
+	Include    []string `toml:"include,omitempty"`
+	RetryCount int      `toml:"retry_count"`
 	// All text files' extensions
-	TextFileExtensions []string       `toml:"text_file_extensions"`
-	Ignores            []Ignore       `toml:"ignores"`
-	PrefixIgnores      []PrefixIgnore `toml:"prefix_ignores"`
+	TextFileExtensions []string        `toml:"text_file_extensions"`
+	Ignores            []Ignore        `toml:"ignores"`
+	PrefixIgnores      []PrefixIgnore  `toml:"prefix_ignores"`
+	PatternIgnores     []PatternIgnore `toml:"pattern_ignores"`
+	Rules              []Rule          `toml:"rules"`
+	// What to do with rules past their expires date: disable (default) or warn
+	ExpiredRules string `toml:"expired_rules,omitempty"`
+	// Directory to store snapshots of locked content in, relative to this file; none if empty
+	SnapshotDir string `toml:"snapshot_dir,omitempty"`
+	// Locked URLs whose content is longer than this (in bytes) fail; 0 means defaultMaxLockContentLength
+	MaxLockContentLength int64 `toml:"max_lock_content_length,omitempty"`
+
+	// All rules in order of precedence, built by Validate
+	rules []Rule
+	// Problems that do not make c invalid, found by Validate
+	warnings []string
+
+	// The file c was read from
+	path string
+	// Prefix of the names of c's rules, e.g. "docs/check_links_config.toml:"; empty for the root configuration
+	rulePrefix string
+	// Configurations included by c, in order of precedence
+	included []*Config
+	// Whether c was read through include, e.g. a base shared among repositories
+	fromInclude bool
+	// Directory of a nested configuration; empty for the root configuration
+	dir string
+	// Configuration files c is merged from, starting with c's own
+	files []string
+	// Where effective settings came from: "retry_count" or an extension -> file
+	sources map[string]string
+	// Nested configurations as read, and as merged with their parents by directory; only in the root configuration
+	nested    []*Config
+	effective map[string]*Config
 }
 
 type LockFile struct {
 	Locks []Lock `toml:"locks"`
+
+	// The bytes read by readLockFile (empty if the file did not exist), to detect modification before writing;
+	// nil if not read from a file
+	read []byte
 }
 
 type Lock struct {
 	URI string `toml:"uri"`
 
-	// h1: SHA-384
-	HashVersion   string `toml:"hash_version,omitempty"`
-	HashOfContent string `toml:"hash_of_content,omitempty"`
+	// h1: hash of the content
+	// h2: hash of the normalized text of the content (see normalizeContent)
+	HashVersion string `toml:"hash_version,omitempty"`
+	// SHA-384 hash; the content matches if this or any of Hashes matches
+	HashOfContent string     `toml:"hash_of_content,omitempty"`
+	Hashes        []LockHash `toml:"hashes,omitempty"`
+
+	// h2 only: matches of these regular expressions, and elements matching these CSS selectors, are left out
+	ExcludeRegexes   []string `toml:"exclude_regexes,omitempty"`
+	ExcludeSelectors []string `toml:"exclude_selectors,omitempty"`
+
+	// Length of the content in bytes, when it was locked
+	ContentLength int64 `toml:"content_length,omitempty"`
+
+	// h2 only: if given, only the elements selected by a CSS selector or an XPath starting with /,
+	// and/or the text between two markers, are hashed
+	Selector    string   `toml:"selector,omitempty"`
+	TextBetween []string `toml:"text_between,omitempty"`
+}
+
+// LockHash is an accepted hash of the content of a lock entry.
+type LockHash struct {
+	// sha256, sha384 or sha512
+	Algorithm string `toml:"algorithm"`
+	Hash      string `toml:"hash"`
 }
 
 type Ignore struct {
@@ -45,154 +108,460 @@ type Ignore struct {
 	Codes                  []int    `toml:"codes"`
 	Reason                 string   `toml:"reason"`
 	ConsideredAlternatives []string `toml:"considered_alternatives"`
+	// If given, the ignore only applies to links in files matching one of these globs
+	Paths    []string  `toml:"paths,omitempty"`
+	Expires  time.Time `toml:"expires,omitempty"`
+	ReviewBy time.Time `toml:"review_by,omitempty"`
 }
 
 type PrefixIgnore struct {
-	Prefix string `toml:"prefix"`
-	Reason string `toml:"reason"`
+	Prefix   string    `toml:"prefix"`
+	Reason   string    `toml:"reason"`
+	Paths    []string  `toml:"paths,omitempty"`
+	Expires  time.Time `toml:"expires,omitempty"`
+	ReviewBy time.Time `toml:"review_by,omitempty"`
+}
+
+// PatternIgnore skips URLs matching a host glob and/or a regular expression.
+// If both are given, both must match.
+type PatternIgnore struct {
+	// Glob (as in path.Match) matched against the URL's host, e.g. "*.slack.com"
+	Host string `toml:"host"`
+	// Regular expression matched against the whole URL; it is anchored at both ends
+	Regex    string    `toml:"regex"`
+	Reason   string    `toml:"reason"`
+	Paths    []string  `toml:"paths,omitempty"`
+	Expires  time.Time `toml:"expires,omitempty"`
+	ReviewBy time.Time `toml:"review_by,omitempty"`
+}
+
+// String describes p for logs and reports.
+func (p *PatternIgnore) String() string {
+	switch {
+	case p.Host != "" && p.Regex != "":
+		return fmt.Sprintf("host = %q, regex = %q", p.Host, p.Regex)
+	case p.Host != "":
+		return fmt.Sprintf("host = %q", p.Host)
+	default:
+		return fmt.Sprintf("regex = %q", p.Regex)
+	}
 }
 
+// Validate returns all problems in c at once, joined with errors.Join.
+// Expired rules and rules expiring or due for review soon are not errors; they are recorded in c.warnings.
 func (c *Config) Validate() error {
-	if len(c.TextFileExtensions) == 0 {
-		return errors.New("text_file_extensions cannot be empty")
+	var errs []error
+	// Nested and included configurations inherit extensions
+	if len(c.TextFileExtensions) == 0 && c.rulePrefix == "" {
+		errs = append(errs, errors.New("text_file_extensions cannot be empty"))
 	}
-	for _, ignore := range c.Ignores {
+	for i, ignore := range c.Ignores {
+		where := fmt.Sprintf("ignores[%d] (url = %q)", i, ignore.URL)
 		if ignore.URL == "" {
-			return errors.New("url cannot be empty")
+			errs = append(errs, fmt.Errorf("ignores[%d]: url cannot be empty", i))
 		}
 		if len(ignore.Codes) == 0 && !ignore.HasTLSError {
-			return errors.New("codes cannot be empty when has_tls_error = false")
+			errs = append(errs, fmt.Errorf("%s: codes cannot be empty when has_tls_error = false", where))
 		}
 		if ignore.Reason == "" {
-			return errors.New("reason cannot be empty")
+			errs = append(errs, fmt.Errorf("%s: reason cannot be empty", where))
 		}
 		if len(ignore.ConsideredAlternatives) == 0 {
-			return errors.New("considered_alternatives cannot be empty")
+			errs = append(errs, fmt.Errorf("%s: considered_alternatives cannot be empty", where))
 		}
 	}
-	for _, prefixIgnore := range c.PrefixIgnores {
+	for i, prefixIgnore := range c.PrefixIgnores {
 		if prefixIgnore.Prefix == "" {
-			return errors.New("prefix cannot be empty")
+			errs = append(errs, fmt.Errorf("prefix_ignores[%d]: prefix cannot be empty", i))
 		}
 		if prefixIgnore.Reason == "" {
-			return errors.New("reason cannot be empty for prefix_ignores")
+			errs = append(errs, fmt.Errorf("prefix_ignores[%d] (prefix = %q): reason cannot be empty for prefix_ignores", i, prefixIgnore.Prefix))
 		}
 	}
-	return nil
+	for i, patternIgnore := range c.PatternIgnores {
+		if patternIgnore.Host == "" && patternIgnore.Regex == "" {
+			errs = append(errs, fmt.Errorf("pattern_ignores[%d]: host or regex must be given", i))
+			continue
+		}
+		if patternIgnore.Reason == "" {
+			errs = append(errs, fmt.Errorf("pattern_ignores[%d] (%s): reason cannot be empty for pattern_ignores", i, &patternIgnore))
+		}
+	}
+	for i, rule := range c.Rules {
+		for _, err := range rule.validate() {
+			errs = append(errs, fmt.Errorf("rules[%d] (%s): %w", i, rule.matcherString(), err))
+		}
+	}
+	rules := c.buildRules()
+	for i := range rules {
+		if rules[i].URL == "" && rules[i].Prefix == "" && rules[i].Host == "" && rules[i].Regex == "" {
+			// already reported
+			continue
+		}
+		if err := rules[i].compile(); err != nil {
+			errs = append(errs, fmt.Errorf("%s (%s): %w", rules[i].origin, rules[i].matcherString(), err))
+		}
+	}
+	if c.MaxLockContentLength < 0 {
+		errs = append(errs, fmt.Errorf("max_lock_content_length cannot be negative: %d", c.MaxLockContentLength))
+	}
+	if c.ExpiredRules != "" && c.ExpiredRules != expiredRulesDisable && c.ExpiredRules != expiredRulesWarn {
+		errs = append(errs, fmt.Errorf("unknown expired_rules: %q (expected disable or warn)", c.ExpiredRules))
+	}
+	c.warnings = nil
+	for _, included := range c.included {
+		if err := included.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("included config %s: %w", included.path, err))
+		}
+		for _, warning := range included.warnings {
+			c.warnings = append(c.warnings, fmt.Sprintf("included config %s: %s", included.path, warning))
+		}
+	}
+	today := toDate(timeNow())
+	for i := range rules {
+		expired, warnings := rules[i].checkExpiry(today)
+		c.warnings = append(c.warnings, warnings...)
+		if !expired {
+			continue
+		}
+		expires := rules[i].Expires.Format(time.DateOnly)
+		if c.ExpiredRules == expiredRulesWarn {
+			c.warnings = append(c.warnings, fmt.Sprintf("%s (%s): expired on %s; review or remove it", rules[i].origin, rules[i].matcherString(), expires))
+		} else {
+			rules[i].disabled = true
+			c.warnings = append(c.warnings, fmt.Sprintf("%s (%s): expired on %s and no longer applies", rules[i].origin, rules[i].matcherString(), expires))
+		}
+	}
+	for _, included := range c.included {
+		rules = append(rules, included.rules...)
+	}
+	c.rules = rules
+	return errors.Join(errs...)
 }
 
+// readConfig decodes the configuration file strictly: syntax errors are reported with their line and column,
+// and keys that Config does not know (e.g. a typo like retry_cout) are rejected.
+// Files in include are read and merged (see readIncludes).
 func readConfig(configFilePath string) (*Config, error) {
+	return readConfigFile(configFilePath, nil)
+}
+
+// readConfigFile reads configFilePath, which is included by the files in including.
+func readConfigFile(configFilePath string, including []string) (*Config, error) {
 	var config Config
 	bytes, err := os.ReadFile(configFilePath)
 	if err != nil {
 		return nil, err
 	}
-	toml.Decode(string(bytes), &config)
+	md, err := toml.Decode(string(bytes), &config)
+	if err != nil {
+		var parseErr toml.ParseError
+		if errors.As(err, &parseErr) {
+			return nil, errors.New(parseErr.ErrorWithPosition())
+		}
+		return nil, err
+	}
+	if err := checkUndecodedKeys(string(bytes), md.Undecoded()); err != nil {
+		return nil, err
+	}
+	config.path = configFilePath
+	config.files = []string{configFilePath}
+	config.sources = map[string]string{"retry_count": configFilePath}
+	for _, ext := range config.TextFileExtensions {
+		config.sources[ext] = configFilePath
+	}
+	if err := config.readIncludes(including); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
 
+// checkUndecodedKeys returns an error listing undecoded keys with their line numbers.
+// Keys under an undecoded table are not listed separately.
+func checkUndecodedKeys(source string, undecoded []toml.Key) error {
+	reported := map[string]struct{}{}
+	occurrences := map[string]int{}
+	var errs []error
+	for _, key := range undecoded {
+		underReported := false
+		for i := 1; i < len(key); i++ {
+			if _, ok := reported[key[:i].String()]; ok {
+				underReported = true
+				break
+			}
+		}
+		if underReported {
+			continue
+		}
+		name := key.String()
+		reported[name] = struct{}{}
+		occurrences[name]++
+		if line := keyLine(source, key, occurrences[name]); line > 0 {
+			errs = append(errs, fmt.Errorf("line %d: unknown key %s", line, name))
+		} else {
+			errs = append(errs, fmt.Errorf("unknown key %s", name))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+var tableHeaderRegex = regexp.MustCompile(`^\s*\[\[?\s*([^\]]*?)\s*\]\]?`)
+var keyValueRegex = regexp.MustCompile(`^\s*([A-Za-z0-9_.-]+)\s*=`)
+
+// keyLine returns the 1-based line on which the n-th occurrence of key is defined, or 0 if not found.
+// It only understands bare keys, which is enough for the keys of Config.
+func keyLine(source string, key toml.Key, n int) int {
+	table := ""
+	for i, line := range strings.Split(source, "\n") {
+		found := false
+		if m := tableHeaderRegex.FindStringSubmatch(line); m != nil {
+			table = m[1]
+			found = table == key.String()
+		} else if m := keyValueRegex.FindStringSubmatch(line); m != nil {
+			full := m[1]
+			if table != "" {
+				full = table + "." + m[1]
+			}
+			found = full == key.String()
+		}
+		if found {
+			n--
+			if n == 0 {
+				return i + 1
+			}
+		}
+	}
+	return 0
+}
+
+// lockSettings are the settings of the configuration file used to fetch and store locked content.
+type lockSettings struct {
+	retryCount int
+	// relative to the current directory; none if empty
+	snapshotDir      string
+	maxContentLength int64
+	// the rules of the configuration file, for timeouts
+	rules []Rule
+}
+
+// timeout returns the timeout of each request for url, which is that of its link check.
+func (s lockSettings) timeout(url string) time.Duration {
+	return matchRule(url, "", s.rules).request(url).Timeout
+}
+
+func (c *Config) lockSettings() lockSettings {
+	settings := lockSettings{
+		retryCount:       max(c.RetryCount, 1),
+		snapshotDir:      c.SnapshotDir,
+		maxContentLength: c.MaxLockContentLength,
+		rules:            c.rules,
+	}
+	if settings.snapshotDir != "" && !filepath.IsAbs(settings.snapshotDir) {
+		settings.snapshotDir = filepath.Join(filepath.Dir(c.path), settings.snapshotDir)
+	}
+	if settings.maxContentLength == 0 {
+		settings.maxContentLength = defaultMaxLockContentLength
+	}
+	return settings
+}
+
 func readLockFile(lockFilePath string) (*LockFile, error) {
 	var lockFile LockFile
-	bytes, err := os.ReadFile(lockFilePath)
+	content, err := os.ReadFile(lockFilePath)
 	if err != nil {
 		// If lock file doesn't exist, return empty lockfile
 		if os.IsNotExist(err) {
-			return &LockFile{Locks: []Lock{}}, nil
+			return &LockFile{Locks: []Lock{}, read: []byte{}}, nil
 		}
 		return nil, err
 	}
-	_, err = toml.Decode(string(bytes), &lockFile)
+	_, err = toml.Decode(string(content), &lockFile)
 	if err != nil {
 		return nil, err
 	}
+	lockFile.read = content
 	return &lockFile, nil
 }
 
+// errLockFileModified is returned when the lock file has changed between reading and writing it.
+var errLockFileModified = errors.New("lock file was modified by another process since it was read; run the command again")
+
+// writeLockFile writes lockFile atomically, so that a crash leaves either the old or the new file.
+// If lockFile was read by readLockFile and the file has changed since, it fails with errLockFileModified.
 func writeLockFile(lockFilePath string, lockFile *LockFile) error {
-	f, err := os.Create(lockFilePath)
+	var buf bytes.Buffer
+	encoder := toml.NewEncoder(&buf)
+	encoder.Indent = ""
+	if err := encoder.Encode(lockFile); err != nil {
+		return err
+	}
+	if lockFile.read != nil {
+		current, err := os.ReadFile(lockFilePath)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		if !bytes.Equal(current, lockFile.read) {
+			return fmt.Errorf("%s: %w", lockFilePath, errLockFileModified)
+		}
+	}
+	if err := writeFileAtomically(lockFilePath, buf.Bytes()); err != nil {
+		return err
+	}
+	lockFile.read = buf.Bytes()
+	return nil
+}
+
+// writeFileAtomically writes data to a temporary file in the directory of path and renames it to path,
+// keeping the permissions of path if it exists.
+func writeFileAtomically(path string, data []byte) error {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	encoder := toml.NewEncoder(f)
-	encoder.Indent = ""
-	return encoder.Encode(lockFile)
+	// Fails harmlessly once renamed
+	defer os.Remove(f.Name())
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
 }
 
-// fetchURLAndComputeSHA384 fetches the content of a URL and computes its SHA384 hash
-func fetchURLAndComputeSHA384(url string) (string, error) {
+// lockLockFile takes an advisory lock for a read-modify-write of the lock file, waiting while another
+// link-checker process holds it. The lock is a sidecar file next to the lock file, removed by unlock.
+func lockLockFile(lockFilePath string) (unlock func(), err error) {
+	return acquireFileLock(lockFilePath + ".lk")
+}
+
+// getLockURL sends a GET request for a lock entry, which times out after timeout (none if 0) unless ctx ends earlier.
+// The caller must close the body of the response.
+func getLockURL(ctx context.Context, url string, timeout time.Duration) (*http.Response, error) {
 	// TODO: move to http_accessor.go
 	// TODO: add a function to perform http.NewRequest("GET", ...) to parameters for easy testing
 	client := http.Client{
-		Timeout: 30 * time.Second,
+		Timeout: timeout,
 	}
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	req.Header.Set("User-Agent", "link-checker from https://github.com/koba-e964/link-checker")
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	defer resp.Body.Close()
-
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("HTTP request to %s failed with status code: %d", url, resp.StatusCode)
-	}
-
-	// Limit response body to 100MB to prevent memory exhaustion
-	limitedBody := io.LimitReader(resp.Body, 100*1024*1024)
-
-	// Compute SHA384 hash
-	// TODO: separate hashing logic into another file
-	hasher := sha512.New384()
-	if _, err := io.Copy(hasher, limitedBody); err != nil {
-		return "", err
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP request to %s failed with status code: %d", url, resp.StatusCode)
 	}
-
-	hashBytes := hasher.Sum(nil)
-	return hex.EncodeToString(hashBytes), nil
+	return resp, nil
 }
 
-// verifyLockEntry verifies that a lock entry's content hash matches the current content
-func verifyLockEntry(lock Lock) error {
-	if lock.HashVersion != "h1" {
-		return fmt.Errorf("unsupported hash version: %s", lock.HashVersion)
+// verifyLockEntry verifies that a lock entry's content hash matches the current content.
+// Fetching is retried settings.retryCount times as link checks are; a mismatch is not retried.
+// If settings.snapshotDir is not empty, a mismatch is reported with a diff from the snapshot of the locked content.
+func verifyLockEntry(ctx context.Context, lock Lock, settings lockSettings) error {
+	if err := lock.validate(); err != nil {
+		return err
 	}
 
 	// Fetch current content and compute hash
-	currentHash, err := fetchURLAndComputeSHA384(lock.URI)
+	var content *fetchedContent
+	err := retry(ctx, settings.retryCount, func() (bool, error) {
+		var err error
+		content, err = fetchLockContent(ctx, lock.URI, settings.timeout(lock.URI), settings.maxContentLength, lock.HashVersion != "h1")
+		// A body over the limit will be over it again
+		return !errors.Is(err, errContentTooLong), err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fetch URL %s: %w", lock.URI, err)
+	}
+	currentHashes, text, err := hashLockContent(lock, content)
 	if err != nil {
-		return fmt.Errorf("failed to fetch and hash URL %s: %w", lock.URI, err)
+		return fmt.Errorf("failed to hash URL %s: %w", lock.URI, err)
 	}
 
-	// Compare hashes
-	if currentHash != lock.HashOfContent {
-		return fmt.Errorf("hash mismatch for URL %s: expected %s, got %s", lock.URI, lock.HashOfContent, currentHash)
+	// Compare hashes; any accepted hash may match
+	accepted := lock.acceptedHashes()
+	if len(accepted) == 0 {
+		return fmt.Errorf("no hash of URL %s is locked", lock.URI)
+	}
+	if len(lock.matchingHashes(currentHashes, "")) == 0 {
+		expected, got := []string{}, []string{}
+		for _, h := range accepted {
+			current := LockHash{Algorithm: h.Algorithm, Hash: currentHashes[h.Algorithm]}.String()
+			expected = append(expected, h.String())
+			if !slices.Contains(got, current) {
+				got = append(got, current)
+			}
+		}
+		message := fmt.Sprintf("hash mismatch for URL %s: expected %s, got %s", lock.URI, strings.Join(expected, " or "), strings.Join(got, ", "))
+		if lock.ContentLength != 0 && lock.ContentLength != content.length {
+			message += fmt.Sprintf(" (length changed from %d to %d bytes)", lock.ContentLength, content.length)
+		}
+		if settings.snapshotDir != "" {
+			message += "\n" + snapshotDiff(settings.snapshotDir, lock, text)
+		}
+		return errors.New(message)
 	}
 
 	return nil
 }
 
-// verifyLockFile verifies all entries in the lock file
-func verifyLockFile(lockFile *LockFile) []error {
+// submitLockVerifications submits the verification of each entry in the lock file to pool.
+// The returned errors, in the order of the entries and nil for verified ones, are set once pool.wait returns.
+func submitLockVerifications(ctx context.Context, pool *workerPool, lockFile *LockFile, settings lockSettings) []error {
+	errs := make([]error, len(lockFile.Locks))
+	for i, lock := range lockFile.Locks {
+		pool.submit(func() {
+			errs[i] = verifyLockEntry(ctx, lock, settings)
+		})
+	}
+	return errs
+}
+
+// verifyLockFile verifies all entries in the lock file concurrently on pool
+func verifyLockFile(ctx context.Context, pool *workerPool, lockFile *LockFile, settings lockSettings) []error {
+	results := submitLockVerifications(ctx, pool, lockFile, settings)
+	pool.wait()
 	var errors []error
-	for _, lock := range lockFile.Locks {
-		if err := verifyLockEntry(lock); err != nil {
+	for _, err := range results {
+		if err != nil {
 			errors = append(errors, err)
 		}
 	}
 	return errors
 }
 
-func addLockEntry(lockFilePath string, uri string, allowUpdate bool) error {
+// addLockEntry adds lock to the lock file, computing its hash. lock.HashVersion defaults to h1, and the hash is
+// computed with algorithm, or if it is empty, with SHA-384 unless lock only has hashes of another algorithm
+// (see Lock.algorithm). If settings.snapshotDir is not empty, a snapshot of the content is stored in it.
+func addLockEntry(ctx context.Context, lockFilePath string, lock Lock, algorithm string, allowUpdate bool, settings lockSettings) error {
+	unlock, err := lockLockFile(lockFilePath)
+	if err != nil {
+		return fmt.Errorf("failed to lock the lock file: %w", err)
+	}
+	defer unlock()
 	lockFile, err := readLockFile(lockFilePath)
 	if err != nil {
 		return err
 	}
-	updatedLockFile, err := addLockEntryPure(lockFile, uri, allowUpdate)
+	updatedLockFile, err := addLockEntryPure(ctx, lockFile, lock, algorithm, allowUpdate, settings)
 	if err != nil {
 		return err
 	}
@@ -200,7 +569,8 @@ func addLockEntry(lockFilePath string, uri string, allowUpdate bool) error {
 	return writeLockFile(lockFilePath, updatedLockFile)
 }
 
-func addLockEntryPure(lockFile *LockFile, uri string, allowUpdate bool) (*LockFile, error) {
+func addLockEntryPure(ctx context.Context, lockFile *LockFile, lock Lock, algorithm string, allowUpdate bool, settings lockSettings) (*LockFile, error) {
+	uri := lock.URI
 	// Check if URI already exists
 	index := -1
 	for i, lock := range lockFile.Locks {
@@ -214,24 +584,56 @@ func addLockEntryPure(lockFile *LockFile, uri string, allowUpdate bool) (*LockFi
 		}
 	}
 
-	// Fetch URL and compute SHA384 hash
-	sha384Hash, err := fetchURLAndComputeSHA384(uri)
+	newLock := lock
+	if newLock.HashVersion == "" {
+		newLock.HashVersion = "h1"
+	}
+	if err := newLock.validate(); err != nil {
+		return nil, err
+	}
+	// Only the accepted hashes of an explicitly given algorithm are compared with the content
+	requested := algorithm
+	if algorithm == "" {
+		algorithm = newLock.algorithm()
+	}
+	if hashAlgorithms[algorithm] == nil {
+		return nil, fmt.Errorf("unsupported hash algorithm: %q", algorithm)
+	}
+
+	// Fetch URL and compute the hash
+	content, err := fetchLockContent(ctx, uri, settings.timeout(uri), settings.maxContentLength, newLock.HashVersion != "h1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch URL and compute hash: %w", err)
+	}
+	hashes, text, err := hashLockContent(newLock, content)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch URL and compute hash: %w", err)
 	}
 
-	// Add new lock entry with computed hash
-	newLock := Lock{
-		URI:           uri,
-		HashVersion:   "h1",
-		HashOfContent: sha384Hash,
+	// Add new lock entry with computed hash, which replaces all accepted hashes unless the content matches one
+	newLock.setHash(algorithm, hashes[algorithm])
+	newLock.ContentLength = content.length
+	// The snapshot of text is stored under the hashes of text
+	snapshotLock := newLock
+	unchanged := false
+	if index != -1 {
+		oldLock := lockFile.Locks[index]
+		if matching := oldLock.matchingHashes(hashes, requested); len(matching) > 0 && oldLock.HashVersion == newLock.HashVersion {
+			// The content is one of the accepted variants, so all of them are kept
+			newLock.HashOfContent, newLock.Hashes, newLock.ContentLength = oldLock.HashOfContent, oldLock.Hashes, oldLock.ContentLength
+			snapshotLock.HashOfContent, snapshotLock.Hashes = "", matching
+			unchanged = true
+		}
+	}
+	if settings.snapshotDir != "" {
+		if err := writeSnapshot(settings.snapshotDir, snapshotLock, text); err != nil {
+			return nil, fmt.Errorf("failed to write snapshot: %w", err)
+		}
 	}
-	if allowUpdate && index != -1 {
-		oldHash := lockFile.Locks[index].HashOfContent
-		if oldHash == sha384Hash {
-			// No change in hash, skip update
-			log.Printf("No change in content for %s, skipping update\n", uri)
-			return lockFile, nil
+	if index != -1 {
+		if unchanged {
+			// The other settings may have changed
+			log.Printf("No change in content for %s\n", uri)
 		} else {
 			log.Printf("Content changed for %s, updating hash\n", uri)
 		}
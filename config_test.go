@@ -1,10 +1,20 @@
 package main
 
 import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestReadLockFile(t *testing.T) {
@@ -89,12 +99,81 @@ func TestWriteLockFile(t *testing.T) {
 	}
 }
 
+func TestWriteLockFileDetectsModification(t *testing.T) {
+	lockPath := filepath.Join(t.TempDir(), "check_links.lock")
+	lockFile, err := readLockFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockFile.Locks = append(lockFile.Locks, Lock{URI: "https://example.com/a", HashVersion: "h1", HashOfContent: "a"})
+	if err := writeLockFile(lockPath, lockFile); err != nil {
+		t.Fatalf("writeLockFile() error = %v, want nil", err)
+	}
+	// The written content is the new base
+	lockFile.Locks[0].HashOfContent = "b"
+	if err := writeLockFile(lockPath, lockFile); err != nil {
+		t.Fatalf("writeLockFile() again error = %v, want nil", err)
+	}
+
+	modified := "# edited by hand\n"
+	if err := os.WriteFile(lockPath, []byte(modified), 0644); err != nil {
+		t.Fatal(err)
+	}
+	lockFile.Locks[0].HashOfContent = "c"
+	if err := writeLockFile(lockPath, lockFile); !errors.Is(err, errLockFileModified) {
+		t.Errorf("writeLockFile() error = %v, want errLockFileModified", err)
+	}
+	if content, _ := os.ReadFile(lockPath); string(content) != modified {
+		t.Errorf("lock file = %q, want it unchanged", content)
+	}
+	// No temporary files are left
+	if entries, _ := os.ReadDir(filepath.Dir(lockPath)); len(entries) != 1 {
+		t.Errorf("directory has %d entries, want only the lock file", len(entries))
+	}
+}
+
+func TestAddLockEntryConcurrently(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Keeps the read-modify-writes overlapping without the lock
+		time.Sleep(10 * time.Millisecond)
+		fmt.Fprintf(w, "content of %s", r.URL.Path)
+	}))
+	defer server.Close()
+
+	lockPath := filepath.Join(t.TempDir(), "check_links.lock")
+	var wg sync.WaitGroup
+	errs := make([]error, 10)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = addLockEntry(context.Background(), lockPath, Lock{URI: fmt.Sprintf("%s/%d", server.URL, i)}, "", false, (&Config{}).lockSettings())
+		}()
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("addLockEntry(%d) error = %v", i, err)
+		}
+	}
+	lockFile, err := readLockFile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lockFile.Locks) != len(errs) {
+		t.Errorf("lock file has %d entries, want %d", len(lockFile.Locks), len(errs))
+	}
+	if _, err := os.Stat(lockPath + ".lk"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Stat(%s.lk) error = %v, want it removed", lockPath, err)
+	}
+}
+
 func TestAddLockEntry(t *testing.T) {
 	tmpDir := t.TempDir()
 	lockPath := filepath.Join(tmpDir, "check_links.lock")
 
 	// Add first entry - using a real URL that should be stable
-	err := addLockEntry(lockPath, "https://example.com", false)
+	err := addLockEntry(context.Background(), lockPath, Lock{URI: "https://example.com"}, "", false, (&Config{}).lockSettings())
 	if err != nil {
 		t.Errorf("addLockEntry() error = %v, want nil", err)
 	}
@@ -119,7 +198,7 @@ func TestAddLockEntry(t *testing.T) {
 	}
 
 	// Try to add duplicate
-	err = addLockEntry(lockPath, "https://example.com", false)
+	err = addLockEntry(context.Background(), lockPath, Lock{URI: "https://example.com"}, "", false, (&Config{}).lockSettings())
 	if err == nil {
 		t.Error("addLockEntry() with duplicate should return error")
 	}
@@ -128,10 +207,11 @@ func TestAddLockEntry(t *testing.T) {
 func TestVerifyLockEntry(t *testing.T) {
 	// Test with a valid lock entry for example.com
 	// First fetch and compute the hash
-	hash, err := fetchURLAndComputeSHA384("https://example.com")
+	content, err := fetchLockContent(context.Background(), "https://example.com", 0, defaultMaxLockContentLength, false)
 	if err != nil {
 		t.Fatalf("Failed to fetch and hash URL: %v", err)
 	}
+	hash := content.hashes[defaultHashAlgorithm]
 
 	// Create a lock entry with the correct hash
 	lock := Lock{
@@ -141,7 +221,7 @@ func TestVerifyLockEntry(t *testing.T) {
 	}
 
 	// Verify should succeed
-	err = verifyLockEntry(lock)
+	err = verifyLockEntry(context.Background(), lock, (&Config{}).lockSettings())
 	if err != nil {
 		t.Errorf("verifyLockEntry() error = %v, want nil", err)
 	}
@@ -153,7 +233,7 @@ func TestVerifyLockEntry(t *testing.T) {
 		HashOfContent: "incorrect_hash",
 	}
 
-	err = verifyLockEntry(lockBadHash)
+	err = verifyLockEntry(context.Background(), lockBadHash, (&Config{}).lockSettings())
 	if err == nil {
 		t.Error("verifyLockEntry() with bad hash should return error")
 	}
@@ -161,20 +241,23 @@ func TestVerifyLockEntry(t *testing.T) {
 	// Test with unsupported hash version
 	lockBadVersion := Lock{
 		URI:           "https://example.com",
-		HashVersion:   "h2",
+		HashVersion:   "h0",
 		HashOfContent: hash,
 	}
 
-	err = verifyLockEntry(lockBadVersion)
+	err = verifyLockEntry(context.Background(), lockBadVersion, (&Config{}).lockSettings())
 	if err == nil {
 		t.Error("verifyLockEntry() with unsupported hash version should return error")
 	}
 }
 
 func TestVerifyLockFile(t *testing.T) {
+	pool := newWorkerPool(2)
+	defer pool.close()
+
 	// Test with empty lock file
 	lockFile := &LockFile{Locks: []Lock{}}
-	errors := verifyLockFile(lockFile)
+	errors := verifyLockFile(context.Background(), pool, lockFile, (&Config{}).lockSettings())
 	if len(errors) != 0 {
 		t.Errorf("verifyLockFile() with empty lock file returned %d errors, want 0", len(errors))
 	}
@@ -184,13 +267,13 @@ func TestVerifyLockFile(t *testing.T) {
 		Locks: []Lock{
 			{
 				URI:           "https://example.com",
-				HashVersion:   "h2",
+				HashVersion:   "h0",
 				HashOfContent: "some_hash",
 			},
 		},
 	}
 
-	errors = verifyLockFile(lockFileWithBadVersion)
+	errors = verifyLockFile(context.Background(), pool, lockFileWithBadVersion, (&Config{}).lockSettings())
 	if len(errors) != 1 {
 		t.Errorf("verifyLockFile() with unsupported hash version returned %d errors, want 1", len(errors))
 	}
@@ -214,8 +297,239 @@ func TestVerifyLockFile(t *testing.T) {
 		},
 	}
 
-	errors = verifyLockFile(lockFileWithBadEntries)
+	errors = verifyLockFile(context.Background(), pool, lockFileWithBadEntries, (&Config{}).lockSettings())
 	if len(errors) != 2 {
 		t.Errorf("verifyLockFile() with 2 bad entries returned %d errors, want 2", len(errors))
 	}
 }
+
+func TestVerifyLockFileConcurrently(t *testing.T) {
+	var mu sync.Mutex
+	requests := map[string]int{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		count := requests[r.URL.Path]
+		mu.Unlock()
+		switch r.URL.Path {
+		case "/flaky":
+			// fails once, then succeeds
+			if count == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		case "/gone":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprintf(w, "content of %s", r.URL.Path)
+	}))
+	defer server.Close()
+
+	hashOf := func(path string) string {
+		sum := sha512.Sum384([]byte("content of " + path))
+		return hex.EncodeToString(sum[:])
+	}
+	lockFile := &LockFile{Locks: []Lock{
+		{URI: server.URL + "/ok", HashVersion: "h1", HashOfContent: hashOf("/ok")},
+		{URI: server.URL + "/flaky", HashVersion: "h1", HashOfContent: hashOf("/flaky")},
+		{URI: server.URL + "/gone", HashVersion: "h1", HashOfContent: hashOf("/gone")},
+		{URI: server.URL + "/changed", HashVersion: "h1", HashOfContent: hashOf("/before")},
+	}}
+	pool := newWorkerPool(4)
+	defer pool.close()
+	errs := verifyLockFile(context.Background(), pool, lockFile, (&Config{RetryCount: 2}).lockSettings())
+	if len(errs) != 2 {
+		t.Fatalf("verifyLockFile() returned %d errors, want 2: %v", len(errs), errs)
+	}
+	// In the order of the entries
+	if !strings.Contains(errs[0].Error(), "status code: 404") || !strings.Contains(errs[1].Error(), "hash mismatch") {
+		t.Errorf("verifyLockFile() = %v, want a 404 and a mismatch", errs)
+	}
+	// Fetch failures are retried, and mismatches are not
+	if requests["/flaky"] != 2 || requests["/gone"] != 2 || requests["/changed"] != 1 {
+		t.Errorf("requests = %v, want 2 for /flaky and /gone and 1 for /changed", requests)
+	}
+}
+
+func TestReadConfigStrict(t *testing.T) {
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "check_links_config.toml")
+
+	tests := []struct {
+		content  string
+		contains []string
+	}{
+		// Syntax errors are reported with line and column
+		{"retry_count = 5\ntext_file_extensions = [\".md\"\n", []string{"At line 2, column"}},
+		// Unknown keys are rejected with their line numbers
+		{`retry_cout = 5
+text_file_extensions = [".md"]
+
+[[ignore]]
+url = "https://example.com"
+
+[[ignores]]
+url = "https://example.com"
+code = [404]
+
+[[ignores]]
+url = "https://example.org"
+code = [404]
+`, []string{"line 1: unknown key retry_cout", "line 4: unknown key ignore\n", "line 9: unknown key ignores.code", "line 13: unknown key ignores.code"}},
+	}
+	for _, test := range tests {
+		if err := os.WriteFile(configPath, []byte(test.content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		_, err := readConfig(configPath)
+		if err == nil {
+			t.Errorf("readConfig(%q) error = nil, want non-nil", test.content)
+			continue
+		}
+		for _, want := range test.contains {
+			if !strings.Contains(err.Error()+"\n", want) {
+				t.Errorf("readConfig(%q) error = %v, want to contain %q", test.content, err, want)
+			}
+		}
+		if strings.Contains(err.Error(), "ignore.url") {
+			t.Errorf("readConfig() error = %v, keys under an unknown table should not be listed", err)
+		}
+	}
+
+	// The repository's own configuration is valid
+	if _, err := readConfig("check_links_config.toml"); err != nil {
+		t.Errorf("readConfig(check_links_config.toml) error = %v, want nil", err)
+	}
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	config := &Config{
+		Ignores: []Ignore{
+			{URL: "https://example.com", Codes: []int{404}, Reason: "ok", ConsideredAlternatives: []string{"none"}},
+			{URL: "https://example.org", Reason: "no codes"},
+		},
+		PrefixIgnores: []PrefixIgnore{
+			{Prefix: "https://x.com/"},
+		},
+		MaxLockContentLength: -1,
+	}
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil, want non-nil")
+	}
+	for _, want := range []string{
+		"text_file_extensions cannot be empty",
+		`ignores[1] (url = "https://example.org"): codes cannot be empty`,
+		`ignores[1] (url = "https://example.org"): considered_alternatives cannot be empty`,
+		`prefix_ignores[0] (prefix = "https://x.com/"): reason cannot be empty`,
+		"max_lock_content_length cannot be negative",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want to contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), `"https://example.com"`) {
+		t.Errorf("Validate() error = %v, ignores[0] is valid", err)
+	}
+}
+
+func TestValidateExpiringRules(t *testing.T) {
+	defer func(saved func() time.Time) { timeNow = saved }(timeNow)
+	timeNow = func() time.Time { return time.Date(2026, 12, 20, 15, 0, 0, 0, time.Local) }
+
+	tmpDir := t.TempDir()
+	configPath := filepath.Join(tmpDir, "check_links_config.toml")
+	content := `text_file_extensions = [".md"]
+
+[[ignores]]
+url = "https://example.com/flaky"
+codes = [200, 404]
+reason = "flaky"
+considered_alternatives = ["none"]
+expires = 2026-12-31
+
+[[prefix_ignores]]
+prefix = "https://x.com/"
+reason = "x.com doesn't seem to allow scraping"
+expires = 2026-12-19
+
+[[prefix_ignores]]
+prefix = "https://y.com/"
+reason = "under review"
+review_by = 2026-12-01
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	config, err := readConfig(configPath)
+	if err != nil {
+		t.Fatalf("readConfig() error = %v, want nil", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	expectedWarnings := []string{
+		`prefix_ignores[0] (prefix = "https://x.com/"): expired on 2026-12-19 and no longer applies`,
+		`prefix_ignores[1] (prefix = "https://y.com/"): review was due on 2026-12-01`,
+		`ignores[0] (url = "https://example.com/flaky"): expires on 2026-12-31 (in 11 days)`,
+	}
+	if !slices.Equal(config.warnings, expectedWarnings) {
+		t.Errorf("warnings = %q, want %q", config.warnings, expectedWarnings)
+	}
+	// The expired rule no longer applies, but the one expiring today still does
+	if rule := matchRule("https://x.com/a", "", config.rules); rule != nil {
+		t.Errorf("matchRule() = %s, want default", rule.name())
+	}
+	timeNow = func() time.Time { return time.Date(2026, 12, 31, 23, 59, 0, 0, time.Local) }
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	if rule := matchRule("https://example.com/flaky", "", config.rules); rule.name() != "ignores[0]" {
+		t.Errorf("matchRule() = %s, want ignores[0]", rule.name())
+	}
+
+	// With expired_rules = "warn", expired rules still apply
+	config.ExpiredRules = expiredRulesWarn
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	if rule := matchRule("https://x.com/a", "", config.rules); rule.name() != "prefix_ignores[0]" {
+		t.Errorf("matchRule() = %s, want prefix_ignores[0]", rule.name())
+	}
+	want := `prefix_ignores[0] (prefix = "https://x.com/"): expired on 2026-12-19; review or remove it`
+	if !slices.Contains(config.warnings, want) {
+		t.Errorf("warnings = %q, want to contain %q", config.warnings, want)
+	}
+
+	config.ExpiredRules = "ignore"
+	if err := config.Validate(); err == nil || !strings.Contains(err.Error(), `unknown expired_rules: "ignore"`) {
+		t.Errorf("Validate() error = %v, want unknown expired_rules", err)
+	}
+}
+
+func TestValidatePatternIgnores(t *testing.T) {
+	config := &Config{
+		TextFileExtensions: []string{".md"},
+		PatternIgnores: []PatternIgnore{
+			{Reason: "no matcher"},
+			{Host: "[", Reason: "bad glob"},
+			{Regex: "(", Reason: "bad regex"},
+			{Host: "*.slack.com"},
+		},
+	}
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil, want non-nil")
+	}
+	for _, want := range []string{
+		"pattern_ignores[0]: host or regex must be given",
+		`pattern_ignores[1] (host = "["): invalid host glob`,
+		`pattern_ignores[2] (regex = "("): invalid regex`,
+		`pattern_ignores[3] (host = "*.slack.com"): reason cannot be empty`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want to contain %q", err, want)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The configuration file is written as text rather than with toml.Encoder, so that comments and ordering are kept.
+
+// tomlString quotes s as a TOML basic string.
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\f':
+			b.WriteString(`\f`)
+		case '\r':
+			b.WriteString(`\r`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// writeIgnore writes ignore as an [[ignores]] table.
+func writeIgnore(w io.Writer, ignore *Ignore) {
+	fmt.Fprintf(w, "[[ignores]]\n")
+	fmt.Fprintf(w, "url = %s\n", tomlString(ignore.URL))
+	if ignore.HasTLSError {
+		fmt.Fprintf(w, "has_tls_error = true # accepts any request error\n")
+	}
+	if len(ignore.Codes) > 0 {
+		codes := []string{}
+		for _, code := range ignore.Codes {
+			codes = append(codes, fmt.Sprint(code))
+		}
+		fmt.Fprintf(w, "codes = [%s]\n", strings.Join(codes, ", "))
+	}
+	fmt.Fprintf(w, "reason = %s\n", tomlString(ignore.Reason))
+	fmt.Fprintf(w, "considered_alternatives = [\n")
+	for _, alternative := range ignore.ConsideredAlternatives {
+		fmt.Fprintf(w, "    %s,\n", tomlString(alternative))
+	}
+	fmt.Fprintf(w, "]\n")
+}
+
+// writePrefixIgnore writes prefixIgnore as a [[prefix_ignores]] table.
+func writePrefixIgnore(w io.Writer, prefixIgnore *PrefixIgnore) {
+	fmt.Fprintf(w, "[[prefix_ignores]]\n")
+	fmt.Fprintf(w, "prefix = %s\n", tomlString(prefixIgnore.Prefix))
+	fmt.Fprintf(w, "reason = %s\n", tomlString(prefixIgnore.Reason))
+}
+
+// appendToConfigFile appends text to the configuration file at configPath, leaving the rest of the file as is.
+// If the result is not a valid configuration, the file is restored.
+func appendToConfigFile(configPath string, text string) error {
+	original, err := os.ReadFile(configPath)
+	if err != nil {
+		return err
+	}
+	content := string(original)
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	content += "\n" + text
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		return err
+	}
+	config, err := readConfig(configPath)
+	if err == nil {
+		err = config.Validate()
+	}
+	if err != nil {
+		if restoreErr := os.WriteFile(configPath, original, 0644); restoreErr != nil {
+			return fmt.Errorf("%w (and failed to restore %s: %v)", err, configPath, restoreErr)
+		}
+		return fmt.Errorf("the result would be invalid, so %s is not changed: %w", configPath, err)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lines of context around each change in a unified diff
+const diffContext = 3
+
+// diffOp is an edit of a line: ' ' (kept), '-' (deleted from a) or '+' (inserted from b).
+type diffOp struct {
+	kind byte
+	line string
+}
+
+// Edits above which myersDiff gives up, bounding its O(D^2) memory
+const maxDiffEdits = 1000
+
+// myersDiff returns the shortest edit script turning a into b, by Myers' O(ND) algorithm,
+// or ok = false if it needs more than maxDiffEdits insertions and deletions.
+func myersDiff(a, b []string) (ops []diffOp, ok bool) {
+	// Lines common to both ends are kept as is
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	ops = []diffOp{}
+	for _, line := range a[:prefix] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	middle, ok := myersDiffMiddle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	if !ok {
+		return nil, false
+	}
+	ops = append(ops, middle...)
+	for _, line := range a[len(a)-suffix:] {
+		ops = append(ops, diffOp{' ', line})
+	}
+	return ops, true
+}
+
+func myersDiffMiddle(a, b []string) ([]diffOp, bool) {
+	n, m := len(a), len(b)
+	maxD := min(n+m, maxDiffEdits)
+	offset := maxD + 1
+	// v[k+offset] is the furthest x on diagonal k; trace[d][k+d] is v[k+offset] before step d, for backtracking
+	// (only diagonals -d..d are reached by then)
+	v := make([]int, 2*maxD+3)
+	trace := [][]int{}
+	var d int
+	found := false
+search:
+	for d = 0; d <= maxD; d++ {
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[k-1+offset] < v[k+1+offset] {
+				// down: insertion
+				x = v[k+1+offset]
+			} else {
+				// right: deletion
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				found = true
+				break search
+			}
+		}
+	}
+	if !found {
+		return nil, false
+	}
+
+	// Backtrack from (n, m) to (0, 0)
+	ops := []diffOp{}
+	x, y := n, m
+	for ; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || k != d && v[k-1+d] < v[k+1+d] {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			ops = append(ops, diffOp{' ', a[x]})
+		}
+		if x == prevX {
+			y--
+			ops = append(ops, diffOp{'+', b[y]})
+		} else {
+			x--
+			ops = append(ops, diffOp{'-', a[x]})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		ops = append(ops, diffOp{' ', a[x]})
+	}
+	for i, j := 0, len(ops)-1; i < j; i, j = i+1, j-1 {
+		ops[i], ops[j] = ops[j], ops[i]
+	}
+	return ops, true
+}
+
+// unifiedDiff returns the differences between the lines of a and b in the unified format, or "" if they are equal.
+// If there are too many to find, only the numbers of lines are compared.
+func unifiedDiff(aName, bName string, a, b []string) string {
+	ops, ok := myersDiff(a, b)
+	if !ok {
+		return fmt.Sprintf("--- %s\n+++ %s\n(too many changes to show: %d lines -> %d lines)\n", aName, bName, len(a), len(b))
+	}
+	var out strings.Builder
+	// index in ops, and line numbers in a and b (0-based) at ops[i]
+	aLines := make([]int, len(ops)+1)
+	bLines := make([]int, len(ops)+1)
+	for i, op := range ops {
+		aLines[i+1], bLines[i+1] = aLines[i], bLines[i]
+		if op.kind != '+' {
+			aLines[i+1]++
+		}
+		if op.kind != '-' {
+			bLines[i+1]++
+		}
+	}
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		// A hunk extends while changes are at most 2*diffContext lines apart
+		start := max(i-diffContext, 0)
+		end := i
+		for j := i; j < len(ops); j++ {
+			if ops[j].kind != ' ' {
+				end = j + 1
+			} else if j-end >= 2*diffContext {
+				break
+			}
+		}
+		end = min(end+diffContext, len(ops))
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", aName, bName)
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n",
+			hunkRange(aLines[start], aLines[end]-aLines[start]), hunkRange(bLines[start], bLines[end]-bLines[start]))
+		for _, op := range ops[start:end] {
+			fmt.Fprintf(&out, "%c%s\n", op.kind, op.line)
+		}
+		i = end
+	}
+	return out.String()
+}
+
+// hunkRange formats the range of a hunk starting at the 0-based line start, as diff -u does.
+func hunkRange(start, count int) string {
+	if count == 0 {
+		// An empty range is denoted by the line before it
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	a := []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15"}
+	b := []string{"1", "2", "3", "4", "five", "6", "7", "8", "9", "10", "11", "12", "13", "14", "15", "16"}
+	want := `--- locked
++++ current
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+@@ -13,3 +13,4 @@
+ 13
+ 14
+ 15
++16
+`
+	if got := unifiedDiff("locked", "current", a, b); got != want {
+		t.Errorf("unifiedDiff() = %s, want %s", got, want)
+	}
+	if got := unifiedDiff("locked", "current", a, a); got != "" {
+		t.Errorf("unifiedDiff() = %q for equal input, want empty", got)
+	}
+	if got := unifiedDiff("locked", "current", nil, nil); got != "" {
+		t.Errorf("unifiedDiff() = %q for empty input, want empty", got)
+	}
+	if got, want := unifiedDiff("a", "b", nil, []string{"x"}), "--- a\n+++ b\n@@ -0,0 +1 @@\n+x\n"; got != want {
+		t.Errorf("unifiedDiff() = %q, want %q", got, want)
+	}
+	// Changes close together are in one hunk
+	if got, want := strings.Count(unifiedDiff("a", "b", []string{"a", "1", "2", "3", "4", "5", "6", "b"}, []string{"A", "1", "2", "3", "4", "5", "6", "B"}), "@@ -"), 1; got != want {
+		t.Errorf("unifiedDiff() has %d hunks, want %d", got, want)
+	}
+
+	// Too many changes are only summarized
+	var many, others []string
+	for i := range 2 * maxDiffEdits {
+		many = append(many, fmt.Sprint(i))
+		others = append(others, fmt.Sprint(-i-1))
+	}
+	if got, want := unifiedDiff("a", "b", many, others[:maxDiffEdits]), fmt.Sprintf("--- a\n+++ b\n(too many changes to show: %d lines -> %d lines)\n", 2*maxDiffEdits, maxDiffEdits); got != want {
+		t.Errorf("unifiedDiff() = %q, want %q", got, want)
+	}
+	// Long inputs differing in a few lines are still diffed
+	changed := append([]string(nil), many...)
+	changed[maxDiffEdits] = "changed"
+	if got := unifiedDiff("a", "b", many, changed); !strings.Contains(got, "-1000\n+changed\n") {
+		t.Errorf("unifiedDiff() = %q, want to contain the changed line", got)
+	}
+
+	dir := filepath.Join(t.TempDir(), "snapshots")
+	lock := Lock{URI: "https://example.com", HashVersion: "h2", HashOfContent: "abc"}
+	if got := snapshotDiff(dir, lock, "new"); !strings.Contains(got, "no snapshot") {
+		t.Errorf("snapshotDiff() = %q, want to contain %q", got, "no snapshot")
+	}
+	if err := writeSnapshot(dir, lock, "title\nold\n"); err != nil {
+		t.Fatalf("writeSnapshot() error = %v, want nil", err)
+	}
+	if got, want := snapshotDiff(dir, lock, "title\nnew"), "--- locked\n+++ current\n@@ -1,2 +1,2 @@\n title\n-old\n+new"; got != want {
+		t.Errorf("snapshotDiff() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// plannedRequest is a request that a check would make.
+type plannedRequest struct {
+	Method string
+	URL    string
+	// 0 means no timeout
+	Timeout time.Duration
+	// maximum number of attempts
+	Attempts int
+	// what decides success, e.g. the applied rule or the lock's hash version
+	Criterion string
+	// where the URL was first found, empty for lock entries
+	Location string
+	// number of places where the URL was found
+	Occurrences int
+}
+
+// checkPlan is what a check would do, computed without any network access.
+type checkPlan struct {
+	Locks    []plannedRequest
+	Links    []plannedRequest
+	Skipped  int
+	NumLinks int
+}
+
+// planCheck performs file reading, extraction, dedupe and rule matching in the same way as checkFile,
+// but only records the requests instead of making them.
+func planCheck(paths []string, config *Config, lockFile *LockFile, readFile FileReader) (*checkPlan, error) {
+	plan := &checkPlan{}
+	if lockFile != nil {
+		for _, lock := range lockFile.Locks {
+			plan.Locks = append(plan.Locks, plannedRequest{
+				Method:    "GET",
+				URL:       lock.URI,
+				Timeout:   config.lockSettings().timeout(lock.URI),
+				Attempts:  config.lockSettings().retryCount,
+				Criterion: fmt.Sprintf("lock (%s)", lock.HashVersion),
+			})
+		}
+	}
+
+	entries, err := listLinks(paths, config, readFile)
+	if err != nil {
+		return nil, err
+	}
+	indices := map[string]int{}
+	for _, entry := range entries {
+		plan.NumLinks++
+		if entry.suppressed {
+			plan.Skipped++
+			continue
+		}
+		fileConfig := config.forFile(entry.File)
+		rule := matchRule(entry.URL, entry.File, fileConfig.rules)
+		if rule != nil && rule.Skip {
+			plan.Skipped++
+			continue
+		}
+		key := seenKey(entry.URL, rule)
+		if i, ok := indices[key]; ok {
+			plan.Links[i].Occurrences++
+			continue
+		}
+		req := rule.request(entry.URL)
+		indices[key] = len(plan.Links)
+		plan.Links = append(plan.Links, plannedRequest{
+			Method:      req.Method,
+			URL:         entry.URL,
+			Timeout:     req.Timeout,
+			Attempts:    fileConfig.RetryCount,
+			Criterion:   entry.Rule,
+			Location:    fmt.Sprintf("%s:%d", entry.File, entry.Line),
+			Occurrences: 1,
+		})
+	}
+	return plan, nil
+}
+
+func writeCheckPlan(w io.Writer, plan *checkPlan) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "lock verifications: %d\n", len(plan.Locks))
+	if len(plan.Locks) > 0 {
+		fmt.Fprintln(tw, "METHOD\tURL\tTIMEOUT\tATTEMPTS\tCRITERION")
+		for _, r := range plan.Locks {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", r.Method, r.URL, formatTimeout(r.Timeout), r.Attempts, r.Criterion)
+		}
+	}
+	fmt.Fprintln(tw)
+	fmt.Fprintf(tw, "link checks: %d requests for %d links (%d skipped by rules or suppressions)\n", len(plan.Links), plan.NumLinks, plan.Skipped)
+	if len(plan.Links) > 0 {
+		fmt.Fprintln(tw, "METHOD\tURL\tTIMEOUT\tATTEMPTS\tCRITERION\tFIRST FOUND AT\tOCCURRENCES")
+		for _, r := range plan.Links {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%d\n", r.Method, r.URL, formatTimeout(r.Timeout), r.Attempts, r.Criterion, r.Location, r.Occurrences)
+		}
+	}
+	return tw.Flush()
+}
+
+func formatTimeout(timeout time.Duration) string {
+	if timeout == 0 {
+		return "none"
+	}
+	return timeout.String()
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPlanCheck(t *testing.T) {
+	config := &Config{
+		RetryCount:         3,
+		TextFileExtensions: []string{".md"},
+		PrefixIgnores: []PrefixIgnore{
+			{Prefix: "https://x.com/", Reason: "X.com links are ignored"},
+		},
+		// Lock entries are fetched with the timeout of their link checks
+		Rules: []Rule{{Prefix: "https://example.org", Timeout: "10s", Reason: "slow"}},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	lockFile := &LockFile{Locks: []Lock{{URI: "https://example.org", HashVersion: "h1", HashOfContent: "def456"}}}
+	readFile := getReadFileMock([]readFileEntry{
+		{"a.md", "https://x.com/user123\nhttps://example.com\n"},
+		{"b.md", "https://example.com\nhttps://github.com/koba-e964\n"},
+	})
+	plan, err := planCheck([]string{"a.md", "b.md"}, config, lockFile, readFile)
+	if err != nil {
+		t.Fatalf("planCheck() error = %v, want nil", err)
+	}
+	expected := &checkPlan{
+		Locks: []plannedRequest{
+			{Method: "GET", URL: "https://example.org", Timeout: 10 * time.Second, Attempts: 3, Criterion: "lock (h1)"},
+		},
+		Links: []plannedRequest{
+			{Method: "HEAD", URL: "https://example.com", Attempts: 3, Criterion: "default (2xx)", Location: "a.md:2", Occurrences: 2},
+			{Method: "HEAD", URL: "https://github.com/koba-e964", Attempts: 3, Criterion: "default (2xx)", Location: "b.md:2", Occurrences: 1},
+		},
+		Skipped:  1,
+		NumLinks: 4,
+	}
+	if !reflect.DeepEqual(plan, expected) {
+		t.Errorf("planCheck() = %+v, want %+v", plan, expected)
+	}
+
+	// Extraction errors are reported
+	if _, err := planCheck([]string{"missing.md"}, config, nil, readFile); err == nil {
+		t.Error("planCheck() with a missing file should return error")
+	}
+}
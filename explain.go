@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// explainURL writes to w how config treats rawURL, without any network access.
+// If file is not empty, it is treated as the file in which rawURL was found.
+func explainURL(w io.Writer, rawURL string, file string, config *Config) {
+	fmt.Fprintf(w, "input: %s\n", rawURL)
+
+	// Extraction: the URL is found with httpRegex/httpsRegex, so characters outside them cut it short.
+	extracted := httpsRegex.FindString(rawURL)
+	if extracted == "" {
+		extracted = httpRegex.FindString(rawURL)
+	}
+	if extracted == "" {
+		fmt.Fprintf(w, "result: not checked: no http:// or https:// link is extracted from the input\n")
+		return
+	}
+	if extracted != rawURL {
+		fmt.Fprintf(w, "extracted: %s (the rest of the input is not part of the link)\n", extracted)
+	}
+	url := stripTitleSuffix(extracted)
+	if url != extracted {
+		fmt.Fprintf(w, "url: %s (:title suffix stripped)\n", url)
+	} else {
+		fmt.Fprintf(w, "url: %s\n", url)
+	}
+
+	// Settings in nested configurations apply to their subtrees
+	config = config.forFile(file)
+	if len(config.files) > 0 {
+		fmt.Fprintf(w, "config: %s (nearest first)\n", strings.Join(config.files, ", "))
+	}
+
+	if file != "" {
+		ext := filepath.Ext(file)
+		if !hasTextFileExtension(file, config.TextFileExtensions) {
+			fmt.Fprintf(w, "file: %s: extension %q is not in text_file_extensions\n", file, ext)
+			fmt.Fprintf(w, "result: not checked: %s is never read\n", file)
+			return
+		}
+		fmt.Fprintf(w, "file: %s: extension %q is in text_file_extensions%s\n", file, ext, config.sourceOf(ext))
+	}
+
+	// Rules are consulted in order of precedence, and the first match wins.
+	rule := matchRule(url, file, config.rules)
+	fmt.Fprintf(w, "rules (in order of precedence, first match wins):\n")
+	if len(config.rules) == 0 {
+		fmt.Fprintf(w, "  (none)\n")
+	}
+	considered := true
+	for i := range config.rules {
+		r := &config.rules[i]
+		switch {
+		case r.disabled:
+			fmt.Fprintf(w, "  %s %s: expired on %s, not applied\n", r.origin, r.matcherString(), r.Expires.Format(time.DateOnly))
+		case r == rule:
+			if pattern, _ := r.scope(file); pattern != "" {
+				fmt.Fprintf(w, "  %s %s: match (wins, scope %s)\n", r.origin, r.matcherString(), pattern)
+			} else {
+				fmt.Fprintf(w, "  %s %s: match (wins)\n", r.origin, r.matcherString())
+			}
+			considered = false
+		case !considered:
+			fmt.Fprintf(w, "  %s %s: not considered\n", r.origin, r.matcherString())
+		case r.Matches(url) && file == "":
+			fmt.Fprintf(w, "  %s %s: match, but only applies to paths %q (use --file)\n", r.origin, r.matcherString(), r.Paths)
+		case r.Matches(url):
+			fmt.Fprintf(w, "  %s %s: match, but %s is out of scope (paths %q)\n", r.origin, r.matcherString(), file, r.Paths)
+		default:
+			fmt.Fprintf(w, "  %s %s: no match\n", r.origin, r.matcherString())
+		}
+	}
+	switch {
+	case rule == nil:
+		fmt.Fprintf(w, "result: checked: HEAD, any 2xx status code is accepted, retry_count = %d%s\n",
+			config.RetryCount, config.sourceOf("retry_count"))
+	case rule.Skip:
+		fmt.Fprintf(w, "result: skipped by %s: reason = %s\n", rule.origin, rule.Reason)
+	default:
+		fmt.Fprintf(w, "result: checked by %s: %s, retry_count = %d%s, reason = %s\n",
+			rule.origin, rule.actionString(), config.RetryCount, config.sourceOf("retry_count"), rule.Reason)
+	}
+}
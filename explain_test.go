@@ -0,0 +1,68 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExplainURL(t *testing.T) {
+	config := &Config{
+		RetryCount:         5,
+		TextFileExtensions: []string{".md"},
+		Ignores: []Ignore{
+			{URL: "https://example.com/flaky", Codes: []int{200, 404}, Reason: "first", ConsideredAlternatives: []string{"none"}},
+			{URL: "https://example.com/flaky", Codes: []int{200, 503}, Reason: "second", ConsideredAlternatives: []string{"none"}},
+		},
+		PrefixIgnores: []PrefixIgnore{
+			{Prefix: "https://x.com/", Reason: "X.com links are ignored"},
+			{Prefix: "https://x.com/user", Reason: "never reached"},
+		},
+		Rules: []Rule{
+			{Prefix: "https://csrc.nist.gov/", Codes: []int{200, 404}, Method: "GET", Timeout: "10s", Reason: "NIST sometimes returns 404"},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		url      string
+		file     string
+		contains []string
+	}{
+		{"https://x.com/user123", "", []string{
+			`rules[0] prefix = "https://csrc.nist.gov/": no match`,
+			`prefix_ignores[0] prefix = "https://x.com/": match (wins)`,
+			`prefix_ignores[1] prefix = "https://x.com/user": not considered`,
+			"result: skipped by prefix_ignores[0]",
+		}},
+		{"https://example.com/flaky:title=Flaky", "README.md", []string{
+			"url: https://example.com/flaky (:title suffix stripped)",
+			// The last entry for the same URL wins
+			`ignores[1] url = "https://example.com/flaky": match (wins)`,
+			`ignores[0] url = "https://example.com/flaky": not considered`,
+			"result: checked by ignores[1]: codes [200 503]",
+		}},
+		{"https://csrc.nist.gov/pubs/fips/186-4/final", "", []string{
+			`rules[0] prefix = "https://csrc.nist.gov/": match (wins)`,
+			"result: checked by rules[0]: codes [200 404], method GET, timeout 10s",
+		}},
+		{"https://github.com/koba-e964", "", []string{
+			"result: checked: HEAD, any 2xx status code is accepted",
+		}},
+		{"https://github.com/koba-e964", "main.go", []string{
+			`extension ".go" is not in text_file_extensions`,
+			"result: not checked",
+		}},
+	}
+
+	for _, test := range tests {
+		var out strings.Builder
+		explainURL(&out, test.url, test.file, config)
+		for _, want := range test.contains {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("explainURL(%q, %q) output does not contain %q:\n%s", test.url, test.file, want, out.String())
+			}
+		}
+	}
+}
@@ -29,9 +29,9 @@ type httpHeadEntry struct {
 }
 
 func getHttpHeadMock(entries []httpHeadEntry) HttpAccessor {
-	return func(url string) (int, error) {
+	return func(req HttpRequest) (int, error) {
 		for _, entry := range entries {
-			if entry.url == url {
+			if entry.url == req.URL {
 				return entry.statusCode, nil
 			}
 		}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+)
+
+// link is a URL found in a file.
+type link struct {
+	// URL with the :title suffix stripped
+	URL string
+	// 1-based line number
+	Line int
+}
+
+// extractLinks returns all HTTP links in content, followed by all HTTPS links.
+func extractLinks(content []byte) []link {
+	links := []link{}
+	for _, regex := range []*regexp.Regexp{httpRegex, httpsRegex} {
+		line, offset := 1, 0
+		for _, loc := range regex.FindAllIndex(content, -1) {
+			line += bytes.Count(content[offset:loc[0]], []byte("\n"))
+			offset = loc[0]
+			links = append(links, link{
+				URL:  stripTitleSuffix(string(content[loc[0]:loc[1]])),
+				Line: line,
+			})
+		}
+	}
+	return links
+}
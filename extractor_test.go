@@ -0,0 +1,21 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestExtractLinks(t *testing.T) {
+	content := []byte("https://example.com/a\nsee http://example.com:title\n\nhttps://example.com/b:title=B and https://example.com/c\n")
+	expected := []link{
+		// HTTP links come first, then HTTPS
+		{URL: "http://example.com", Line: 2},
+		{URL: "https://example.com/a", Line: 1},
+		{URL: "https://example.com/b", Line: 4},
+		{URL: "https://example.com/c", Line: 4},
+	}
+	links := extractLinks(content)
+	if !reflect.DeepEqual(links, expected) {
+		t.Errorf("extractLinks() = %v, want %v", links, expected)
+	}
+}
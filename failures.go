@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+)
+
+// Exit codes of link-checker.
+//
+// When a run fails for several reasons, the code of the category listed first in failureCategory wins.
+const (
+	exitOK = 0
+	// check found dead links; other commands also use it for failures outside the categories below
+	exitFailure = 1
+	// invalid command line, as the flag package does
+	exitUsage = 2
+	// the configuration file is missing or invalid
+	exitConfigError = 3
+	// files could not be listed or read
+	exitIOError = 4
+	// a locked URL's content changed or could not be verified
+	exitLockMismatch = 5
+	// some requests timed out, so the result is incomplete
+	exitIncomplete = 6
+)
+
+// failureCategory classifies why a run failed. Categories are in order of precedence.
+type failureCategory int
+
+const (
+	failureConfig failureCategory = iota
+	failureIO
+	failureLockMismatch
+	failureDeadLink
+	failureIncomplete
+	numFailureCategories
+)
+
+var failureCategoryInfo = [numFailureCategories]struct {
+	name     string
+	exitCode int
+}{
+	failureConfig:       {"config errors", exitConfigError},
+	failureIO:           {"extraction/IO errors", exitIOError},
+	failureLockMismatch: {"lock mismatches", exitLockMismatch},
+	failureDeadLink:     {"dead links", exitFailure},
+	failureIncomplete:   {"timeouts", exitIncomplete},
+}
+
+// failures aggregates the failures of a run by category.
+type failures struct {
+	counts [numFailureCategories]int
+}
+
+func (f *failures) add(category failureCategory, err error) {
+	f.counts[category]++
+	log.Printf("%v\n", err)
+}
+
+// addLinkErrors records the errors returned by checkFile: each linkError in err's tree
+// is a dead link or a timeout, and anything else is an extraction/IO error.
+func (f *failures) addLinkErrors(err error) {
+	linkErrors, others := splitLinkErrors(err)
+	for _, other := range others {
+		f.add(failureIO, other)
+	}
+	for _, le := range linkErrors {
+		if isTimeout(le.Err) {
+			f.counts[failureIncomplete]++
+		} else {
+			f.counts[failureDeadLink]++
+		}
+	}
+}
+
+// splitLinkErrors returns the linkErrors in err's tree, and the other errors in it.
+func splitLinkErrors(err error) (linkErrors []*linkError, others []error) {
+	var le *linkError
+	switch e := err.(type) {
+	case nil:
+		return nil, nil
+	case *linkError:
+		return []*linkError{e}, nil
+	case interface{ Unwrap() []error }:
+		for _, inner := range e.Unwrap() {
+			innerLinkErrors, innerOthers := splitLinkErrors(inner)
+			linkErrors = append(linkErrors, innerLinkErrors...)
+			others = append(others, innerOthers...)
+		}
+		return linkErrors, others
+	case interface{ Unwrap() error }:
+		if errors.As(err, &le) {
+			return splitLinkErrors(e.Unwrap())
+		}
+	}
+	return nil, []error{err}
+}
+
+// addLockErrors records the errors returned by verifyLockFile.
+func (f *failures) addLockErrors(errs []error) {
+	for _, err := range errs {
+		if isTimeout(err) {
+			f.add(failureIncomplete, err)
+		} else {
+			f.add(failureLockMismatch, err)
+		}
+	}
+}
+
+// exitCode returns the exit code of the category with the highest precedence.
+func (f *failures) exitCode() int {
+	for category, count := range f.counts {
+		if count > 0 {
+			return failureCategoryInfo[category].exitCode
+		}
+	}
+	return exitOK
+}
+
+// String summarizes the counts, e.g. "2 dead links, 1 timeouts".
+func (f *failures) String() string {
+	parts := []string{}
+	for category, count := range f.counts {
+		if count > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count, failureCategoryInfo[category].name))
+		}
+	}
+	if len(parts) == 0 {
+		return "no failures"
+	}
+	return strings.Join(parts, ", ")
+}
+
+// linkError is a link that failed the liveness check.
+type linkError struct {
+	Path string
+	Line int
+	URL  string
+	Err  error
+}
+
+func (e *linkError) Error() string {
+	return fmt.Sprintf("%s:%d: not alive: url = %s , thiserror = %v", e.Path, e.Line, e.URL, e.Err)
+}
+
+func (e *linkError) Unwrap() error {
+	return e.Err
+}
+
+// statusCodeError is a response with a status code that is not accepted.
+type statusCodeError struct {
+	StatusCode int
+}
+
+func (e *statusCodeError) Error() string {
+	return fmt.Sprintf("invalid status code: %d", e.StatusCode)
+}
+
+// isTimeout reports whether err is caused by a timeout or an interrupt, in which case liveness is unknown.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) || errors.Is(err, context.Canceled) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+)
+
+func TestFailuresExitCode(t *testing.T) {
+	var httpHead HttpAccessor = func(req HttpRequest) (int, error) {
+		switch req.URL {
+		case "https://dead.example.com":
+			return 404, nil
+		case "https://slow.example.com":
+			return 0, &net.DNSError{Err: "timeout", Name: "slow.example.com", IsTimeout: true}
+		}
+		return 200, nil
+	}
+	readFile := getReadFileMock([]readFileEntry{
+		{"ok.md", "https://example.com\n"},
+		{"slow.md", "https://slow.example.com\n"},
+		{"dead.md", "https://dead.example.com\nhttps://slow.example.com\n"},
+	})
+	tests := []struct {
+		paths    []string
+		expected int
+		summary  string
+	}{
+		{[]string{"ok.md"}, exitOK, "no failures"},
+		{[]string{"slow.md"}, exitIncomplete, "1 timeouts"},
+		{[]string{"slow.md", "dead.md"}, exitFailure, "1 dead links, 1 timeouts"},
+		{[]string{"missing.md", "dead.md"}, exitIOError, "1 extraction/IO errors, 1 dead links, 1 timeouts"},
+	}
+	for _, test := range tests {
+		failures := &failures{}
+		seen := newSeenURLs()
+		for _, path := range test.paths {
+			if err := checkFile(context.Background(), path, 1, nil, seen, readFile, httpHead); err != nil {
+				failures.addLinkErrors(err)
+			}
+		}
+		if code := failures.exitCode(); code != test.expected {
+			t.Errorf("%v: exitCode() = %d, want %d", test.paths, code, test.expected)
+		}
+		if summary := failures.String(); summary != test.summary {
+			t.Errorf("%v: String() = %q, want %q", test.paths, summary, test.summary)
+		}
+	}
+
+	failures := &failures{}
+	failures.addLinkErrors(errors.New("dummy"))
+	failures.addLockErrors([]error{errors.New("hash mismatch")})
+	if code := failures.exitCode(); code != exitIOError {
+		t.Errorf("exitCode() = %d, want %d", code, exitIOError)
+	}
+	failures.add(failureConfig, errors.New("dummy"))
+	if code := failures.exitCode(); code != exitConfigError {
+		t.Errorf("exitCode() = %d, want %d", code, exitConfigError)
+	}
+}
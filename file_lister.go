@@ -2,8 +2,12 @@ package main
 
 import (
 	"errors"
+	"fmt"
 	"log"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -19,3 +23,25 @@ func listFiles() ([]string, error) {
 	paths = paths[:len(paths)-1] // excludes the last element after the last newline
 	return paths, nil
 }
+
+// hasTextFileExtension reports whether path has one of extensions.
+func hasTextFileExtension(path string, extensions []string) bool {
+	return slices.Contains(extensions, filepath.Ext(path))
+}
+
+// selectTextFiles returns the regular files in paths that have one of the extensions configured for them.
+// Paths that cannot be stat'ed are skipped and reported in errs.
+// The functions reading links from files (e.g. listLinks, planCheck and auditRules) expect paths filtered by it.
+func selectTextFiles(paths []string, config *Config) (textFiles []string, errs []error) {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("path = %s, %w", path, err))
+			continue
+		}
+		if !info.IsDir() && hasTextFileExtension(path, config.forFile(path).TextFileExtensions) {
+			textFiles = append(textFiles, path)
+		}
+	}
+	return textFiles, errs
+}
@@ -0,0 +1,39 @@
+//go:build !unix || aix || solaris
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// Where flock is not available, the lock file is created exclusively instead
+
+// How long acquireFileLock waits for another process to release the lock
+const fileLockTimeout = 10 * time.Minute
+
+// acquireFileLock creates path exclusively, waiting while it exists for up to fileLockTimeout.
+// release removes path. A path left behind by a crashed process must be removed by hand.
+func acquireFileLock(path string) (release func(), err error) {
+	deadline := time.Now().Add(fileLockTimeout)
+	for waiting := false; ; waiting = true {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s still exists after %v; remove it if no link-checker is running", path, fileLockTimeout)
+		}
+		if !waiting {
+			log.Printf("Waiting for another link-checker to release %s...\n", path)
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
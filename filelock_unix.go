@@ -0,0 +1,51 @@
+//go:build unix && !aix && !solaris
+
+package main
+
+import (
+	"errors"
+	"log"
+	"os"
+	"syscall"
+)
+
+// acquireFileLock creates path if needed and takes an exclusive flock on it, waiting until it is available.
+// release removes path and releases the lock.
+func acquireFileLock(path string) (release func(), err error) {
+	for {
+		f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		if err := flock(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		// The previous holder removes path on release, possibly after we opened it; then lock the new file instead
+		locked, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err == nil && os.SameFile(locked, current) {
+			return func() {
+				os.Remove(path)
+				f.Close()
+			}, nil
+		}
+		f.Close()
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+}
+
+func flock(f *os.File) error {
+	err := syscall.Flock(int(f.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		log.Printf("Waiting for another link-checker to release %s...\n", f.Name())
+		err = syscall.Flock(int(f.Fd()), syscall.LOCK_EX)
+	}
+	return err
+}
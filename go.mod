@@ -1,5 +1,9 @@
 module github.com/koba-e964/link-checker
 
-go 1.23
+go 1.23.0
 
-require github.com/BurntSushi/toml v1.3.2
+require (
+	github.com/BurntSushi/toml v1.3.2
+	github.com/andybalholm/cascadia v1.3.3
+	golang.org/x/net v0.43.0
+)
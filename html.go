@@ -0,0 +1,73 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// parseHTML parses s as a browser does, by the HTML5 tree construction algorithm
+// (e.g. rows of a table are put in an implied tbody).
+func parseHTML(s string) *html.Node {
+	// html.Parse fails only if reading fails, which a strings.Reader does not
+	root, _ := html.Parse(strings.NewReader(s))
+	return root
+}
+
+// attribute returns the value of the attribute key of n, and whether it exists.
+func attribute(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// Elements whose content is never rendered
+var hiddenElements = []string{"head", "script", "style", "noscript", "template"}
+
+// Elements that start a new line of text
+var blockElements = []string{"address", "article", "aside", "blockquote", "br", "caption", "dd", "div", "dl", "dt",
+	"fieldset", "figcaption", "figure", "footer", "form", "h1", "h2", "h3", "h4", "h5", "h6", "header", "hr", "li",
+	"main", "nav", "ol", "p", "pre", "section", "table", "td", "th", "tr", "ul"}
+
+// visibleText returns the text of n that a browser would render, leaving out elements for which exclude returns true.
+// Block elements are separated by newlines; other whitespace in the source is turned into spaces.
+func visibleText(n *html.Node, exclude func(*html.Node) bool) string {
+	var b strings.Builder
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		switch n.Type {
+		case html.TextNode:
+			b.WriteString(strings.Map(func(r rune) rune {
+				if r == '\n' || r == '\r' {
+					return ' '
+				}
+				return r
+			}, n.Data))
+			return
+		case html.ElementNode:
+			if _, hidden := attribute(n, "hidden"); hidden || slices.Contains(hiddenElements, n.Data) || exclude(n) {
+				return
+			}
+		case html.DocumentNode:
+		default:
+			// comments and doctypes
+			return
+		}
+		block := n.Type == html.ElementNode && slices.Contains(blockElements, n.Data)
+		if block {
+			b.WriteByte('\n')
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+		if block {
+			b.WriteByte('\n')
+		}
+	}
+	walk(n)
+	return b.String()
+}
@@ -1,20 +1,37 @@
 package main
 
-import "net/http"
+import (
+	"net/http"
+	"time"
+)
 
-type HttpAccessor = func(url string) (int, error)
+// HttpRequest is a request made to check a link.
+type HttpRequest struct {
+	// HEAD or GET
+	Method string
+	URL    string
+	// 0 means no timeout
+	Timeout time.Duration
+	Headers map[string]string
+}
+
+type HttpAccessor = func(req HttpRequest) (int, error)
 
 // Returns the status code.
-func httpHead(url string) (int, error) {
-	client := http.Client{}
-	req, err := http.NewRequest("HEAD", url, nil)
+func sendHttpRequest(req HttpRequest) (int, error) {
+	client := http.Client{Timeout: req.Timeout}
+	httpReq, err := http.NewRequest(req.Method, req.URL, nil)
 	if err != nil {
 		return 0, err
 	}
-	req.Header.Set("User-Agent", "link-checker from https://github.com/koba-e964/link-checker")
-	resp, err := client.Do(req)
+	httpReq.Header.Set("User-Agent", "link-checker from https://github.com/koba-e964/link-checker")
+	for key, value := range req.Headers {
+		httpReq.Header.Set(key, value)
+	}
+	resp, err := client.Do(httpReq)
 	if err != nil {
 		return 0, err
 	}
+	defer resp.Body.Close()
 	return resp.StatusCode, nil
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// readIncludes reads the files in c.Include, relative to c's file, and merges their settings into c.
+// c takes precedence over the files it includes, and an earlier file in c.Include over a later one:
+// c's rules come first, retry_count is taken from the first file that sets it, and extensions are unioned.
+// including lists the files that (transitively) include c, for cycle detection.
+func (c *Config) readIncludes(including []string) error {
+	absPath, err := filepath.Abs(c.path)
+	if err != nil {
+		return err
+	}
+	including = append(slices.Clone(including), absPath)
+	for _, include := range c.Include {
+		if strings.Contains(include, "://") {
+			return fmt.Errorf("include = %q: only local files can be included", include)
+		}
+		includePath := include
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(c.path), include)
+		}
+		absIncludePath, err := filepath.Abs(includePath)
+		if err != nil {
+			return err
+		}
+		if i := slices.Index(including, absIncludePath); i >= 0 {
+			cycle := append(slices.Clone(including[i:]), absIncludePath)
+			return fmt.Errorf("include cycle: %s", strings.Join(cycle, " -> "))
+		}
+		included, err := readConfigFile(includePath, including)
+		if err != nil {
+			return fmt.Errorf("failed to read included config %s: %w", includePath, err)
+		}
+		included.rulePrefix = includePath + ":"
+		included.fromInclude = true
+		c.included = append(c.included, included)
+		c.files = append(c.files, included.files...)
+		if c.RetryCount == 0 && included.RetryCount != 0 {
+			c.RetryCount = included.RetryCount
+			c.sources["retry_count"] = included.sources["retry_count"]
+		}
+		for _, ext := range included.TextFileExtensions {
+			if !slices.Contains(c.TextFileExtensions, ext) {
+				c.TextFileExtensions = append(c.TextFileExtensions, ext)
+				c.sources[ext] = included.sources[ext]
+			}
+		}
+	}
+	return nil
+}
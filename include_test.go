@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestReadConfigWithIncludes(t *testing.T) {
+	tmpDir := t.TempDir()
+	repoDir := filepath.Join(tmpDir, "repo")
+	sharedDir := filepath.Join(tmpDir, "shared")
+	configPath := filepath.Join(repoDir, "check_links_config.toml")
+	basePath := filepath.Join(sharedDir, "link-checker-base.toml")
+	socialPath := filepath.Join(sharedDir, "social.toml")
+	files := map[string]string{
+		configPath: `include = ["../shared/link-checker-base.toml"]
+text_file_extensions = [".md"]
+
+[[prefix_ignores]]
+prefix = "https://x.com/koba-e964"
+reason = "our own account is checked"
+`,
+		basePath: `include = ["social.toml"]
+retry_count = 5
+text_file_extensions = [".md", ".go"]
+
+[[ignores]]
+url = "https://example.com/flaky"
+codes = [200, 503]
+reason = "flaky"
+considered_alternatives = ["none"]
+`,
+		socialPath: `retry_count = 1
+
+[[prefix_ignores]]
+prefix = "https://x.com/"
+reason = "x.com doesn't seem to allow scraping"
+
+[[prefix_ignores]]
+prefix = "https://www.linkedin.com/"
+reason = "LinkedIn requires login"
+`,
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	config, err := readConfig(configPath)
+	if err != nil {
+		t.Fatalf("readConfig() error = %v, want nil", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	if config.RetryCount != 5 || !slices.Equal(config.TextFileExtensions, []string{".md", ".go"}) {
+		t.Errorf("RetryCount = %d, TextFileExtensions = %v, want 5 and [.md .go]", config.RetryCount, config.TextFileExtensions)
+	}
+	// Rules and settings are named after the included files as resolved
+	base := filepath.Join(repoDir, "../shared/link-checker-base.toml")
+	social := filepath.Join(filepath.Dir(base), "social.toml")
+	if got := config.sourceOf(".go"); got != " (from "+base+")" {
+		t.Errorf("sourceOf(.go) = %q", got)
+	}
+	// The including file takes precedence
+	for url, expected := range map[string]string{
+		"https://x.com/koba-e964":       "prefix_ignores[0]",
+		"https://x.com/someone":         social + ":prefix_ignores[0]",
+		"https://www.linkedin.com/in/a": social + ":prefix_ignores[1]",
+		"https://example.com/flaky":     base + ":ignores[0]",
+	} {
+		if name := matchRule(url, "", config.rules).name(); name != expected {
+			t.Errorf("matchRule(%q) = %s, want %s", url, name, expected)
+		}
+	}
+
+	// Cycles are detected
+	if err := os.WriteFile(socialPath, []byte(`include = ["../repo/check_links_config.toml"]`), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if _, err := readConfig(configPath); err == nil || !strings.Contains(err.Error(), "include cycle: ") {
+		t.Errorf("readConfig() error = %v, want an include cycle", err)
+	}
+}
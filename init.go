@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Default retry_count written by init
+const initRetryCount = 5
+
+// proposeExtensions returns the extensions of the files in paths that contain links, sorted.
+// Files without an extension, files that cannot be read (e.g. submodules) and binary files are not considered.
+func proposeExtensions(paths []string, readFile FileReader) []string {
+	extensions := []string{}
+	for _, path := range paths {
+		ext := filepath.Ext(path)
+		if ext == "" || slices.Contains(extensions, ext) {
+			continue
+		}
+		content, err := readFile(path)
+		if err != nil || isBinary(content) {
+			continue
+		}
+		if len(extractLinks(content)) > 0 {
+			extensions = append(extensions, ext)
+		}
+	}
+	slices.Sort(extensions)
+	return extensions
+}
+
+// withoutOwnFiles returns paths except link-checker's own files: the configuration files (nested ones too)
+// and the lock file, whose extensions should not be proposed.
+func withoutOwnFiles(paths []string, configPath string, lockPath string) []string {
+	own := []string{filepath.Clean(configPath), filepath.Clean(lockPath)}
+	configName := filepath.Base(defaultConfigFilePath)
+	return slices.DeleteFunc(slices.Clone(paths), func(path string) bool {
+		return slices.Contains(own, filepath.Clean(path)) || filepath.Base(path) == configName
+	})
+}
+
+// isBinary reports whether content looks binary, in the same way as git: it has a NUL byte near the beginning.
+func isBinary(content []byte) bool {
+	return bytes.IndexByte(content[:min(len(content), 8000)], 0) >= 0
+}
+
+// writeInitialConfig writes a configuration with extensions and an [[ignores]] stub for each failure.
+// The stubs are valid, but their reasons and alternatives are placeholders to be filled in.
+func writeInitialConfig(w io.Writer, extensions []string, failures []*linkError) {
+	fmt.Fprintf(w, "# Generated by link-checker init. Review the TODOs before committing.\n")
+	fmt.Fprintf(w, "# how many times link-checker retries before giving up\n")
+	fmt.Fprintf(w, "retry_count = %d\n", initRetryCount)
+	fmt.Fprintf(w, "# extensions of the files that contained links\n")
+	fmt.Fprintf(w, "text_file_extensions = [\n")
+	for _, ext := range extensions {
+		fmt.Fprintf(w, "    %s,\n", tomlString(ext))
+	}
+	fmt.Fprintf(w, "]\n")
+	for _, failure := range failures {
+		// The error is in a comment, so it must be on one line
+		fmt.Fprintf(w, "\n# %s:%d: %s\n", failure.Path, failure.Line, strings.ReplaceAll(failure.Err.Error(), "\n", " "))
+		ignore := &Ignore{
+			URL:                    failure.URL,
+			Reason:                 "TODO: why this link cannot be fixed",
+			ConsideredAlternatives: []string{"TODO: links considered instead"},
+		}
+		var statusErr *statusCodeError
+		if errors.As(failure.Err, &statusErr) {
+			ignore.Codes = []int{statusErr.StatusCode}
+		} else {
+			ignore.HasTLSError = true
+		}
+		writeIgnore(w, ignore)
+	}
+}
+
+// initConfig proposes extensions for paths, checks the links in the files with them retryCount times
+// (not at all if retryCount is 0), and writes the configuration to w.
+func initConfig(ctx context.Context, w io.Writer, paths []string, retryCount int, readFile FileReader, httpAccess HttpAccessor) error {
+	extensions := proposeExtensions(paths, readFile)
+	if len(extensions) == 0 {
+		return errors.New("no file contains links")
+	}
+	var failures []*linkError
+	if retryCount > 0 {
+		seen := newSeenURLs()
+		for _, path := range paths {
+			if !hasTextFileExtension(path, extensions) {
+				continue
+			}
+			linkErrors, others := splitLinkErrors(checkFile(ctx, path, retryCount, nil, seen, readFile, httpAccess))
+			for _, other := range others {
+				// e.g. a submodule, which cannot be read
+				log.Printf("Warning: %v\n", other)
+			}
+			failures = append(failures, linkErrors...)
+		}
+	}
+	writeInitialConfig(w, extensions, failures)
+	return nil
+}
+
+// initConfigFile writes the configuration made by initConfig to configPath, which must not exist unless force.
+// The configuration files and the lock file at lockPath among paths are not considered.
+func initConfigFile(ctx context.Context, configPath string, lockPath string, paths []string, noCheck bool, force bool) error {
+	if _, err := os.Stat(configPath); err == nil && !force {
+		return fmt.Errorf("%s already exists (use --force to overwrite it)", configPath)
+	}
+	retryCount := initRetryCount
+	if noCheck {
+		retryCount = 0
+	}
+	var b strings.Builder
+	if err := initConfig(ctx, &b, withoutOwnFiles(paths, configPath, lockPath), retryCount, readFile, sendHttpRequest); err != nil {
+		return err
+	}
+	return os.WriteFile(configPath, []byte(b.String()), 0644)
+}
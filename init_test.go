@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestInitConfig(t *testing.T) {
+	readFile := getReadFileMock([]readFileEntry{
+		{"README.md", "https://example.com/ok\nhttps://example.com/gone\n"},
+		{"docs/guide.md", "https://example.com/ok\n"},
+		{"main.go", "// see https://example.com/down\n"},
+		{"main_test.go", "package main\n"},
+		{"Makefile", "https://example.com/ok\n"},
+		{"logo.png", "\x89PNG\x00https://example.com/ok"},
+		{"notes.txt", "no links\n"},
+	})
+	paths := []string{"README.md", "docs/guide.md", "main.go", "main_test.go", "Makefile", "logo.png", "notes.txt", "submodule"}
+	if got, want := proposeExtensions(paths, readFile), []string{".go", ".md"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("proposeExtensions() = %v, want %v", got, want)
+	}
+
+	var httpAccess HttpAccessor = func(req HttpRequest) (int, error) {
+		switch req.URL {
+		case "https://example.com/gone":
+			return 404, nil
+		case "https://example.com/down":
+			return 0, &net.OpError{Op: "dial", Err: errors.New("connection refused")}
+		}
+		return 200, nil
+	}
+	var b strings.Builder
+	if err := initConfig(context.Background(), &b, paths, 1, readFile, httpAccess); err != nil {
+		t.Fatalf("initConfig() error = %v, want nil", err)
+	}
+	for _, want := range []string{
+		"text_file_extensions = [\n    \".go\",\n    \".md\",\n]\n",
+		"# README.md:2: invalid status code: 404\n[[ignores]]\nurl = \"https://example.com/gone\"\ncodes = [404]\n",
+		"[[ignores]]\nurl = \"https://example.com/down\"\nhas_tls_error = true",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("initConfig() = %s, want to contain %q", b.String(), want)
+		}
+	}
+
+	// The generated configuration is valid
+	configPath := filepath.Join(t.TempDir(), "check_links_config.toml")
+	if err := os.WriteFile(configPath, []byte(b.String()), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	config, err := readConfig(configPath)
+	if err != nil {
+		t.Fatalf("readConfig() error = %v, want nil", err)
+	}
+	if err := config.Validate(); err != nil {
+		t.Errorf("Validate() error = %v, want nil", err)
+	}
+	if len(config.Ignores) != 2 {
+		t.Errorf("len(Ignores) = %d, want 2", len(config.Ignores))
+	}
+}
+
+func TestWithoutOwnFiles(t *testing.T) {
+	paths := []string{"README.md", "check_links_config.toml", "docs/check_links_config.toml", "check_links.lock", "ci/links.toml", "docs/links.toml"}
+	got := withoutOwnFiles(paths, "./ci/links.toml", defaultLockFilePath)
+	if want := []string{"README.md", "docs/links.toml"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("withoutOwnFiles() = %v, want %v", got, want)
+	}
+}
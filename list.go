@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// linkEntry is a link found in a file, together with the rule that applies to it.
+type linkEntry struct {
+	File string `json:"file"`
+	Line int    `json:"line"`
+	URL  string `json:"url"`
+	Rule string `json:"rule"`
+
+	// suppressed by an inline marker
+	suppressed bool
+	// skipped by the matching rule
+	skipped bool
+}
+
+// hostCount aggregates linkEntry's by host.
+type hostCount struct {
+	Host string `json:"host"`
+	// number of occurrences
+	Links int `json:"links"`
+	// number of distinct URLs
+	URLs int `json:"urls"`
+	// number of distinct files
+	Files int `json:"files"`
+}
+
+type linkInventory struct {
+	Links []linkEntry `json:"links"`
+	Hosts []hostCount `json:"hosts"`
+}
+
+// listLinks extracts links from paths without any network access.
+func listLinks(paths []string, config *Config, readFile FileReader) ([]linkEntry, error) {
+	entries := []linkEntry{}
+	for _, path := range paths {
+		content, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		suppressions, errs := parseSuppressions(path, content)
+		if len(errs) > 0 {
+			return nil, errors.Join(errs...)
+		}
+		for _, link := range extractLinks(content) {
+			if s := suppressionAt(link.Line, suppressions); s != nil {
+				entries = append(entries, linkEntry{
+					File:       path,
+					Line:       link.Line,
+					URL:        link.URL,
+					Rule:       fmt.Sprintf("suppressed at line %d", s.Line),
+					suppressed: true,
+				})
+				continue
+			}
+			rules := config.forFile(path).rules
+			rule := matchRule(link.URL, path, rules)
+			entries = append(entries, linkEntry{
+				File:    path,
+				Line:    link.Line,
+				URL:     link.URL,
+				Rule:    describeRule(link.URL, path, rules),
+				skipped: rule != nil && rule.Skip,
+			})
+		}
+	}
+	return entries, nil
+}
+
+// countHosts aggregates entries by host, sorted by the number of occurrences in descending order.
+func countHosts(entries []linkEntry) []hostCount {
+	type sets struct {
+		links int
+		urls  map[string]struct{}
+		files map[string]struct{}
+	}
+	byHost := map[string]*sets{}
+	for _, entry := range entries {
+		host := entry.URL
+		if parsed, err := url.Parse(entry.URL); err == nil {
+			host = parsed.Host
+		}
+		s, ok := byHost[host]
+		if !ok {
+			s = &sets{urls: map[string]struct{}{}, files: map[string]struct{}{}}
+			byHost[host] = s
+		}
+		s.links++
+		s.urls[entry.URL] = struct{}{}
+		s.files[entry.File] = struct{}{}
+	}
+	counts := []hostCount{}
+	for host, s := range byHost {
+		counts = append(counts, hostCount{Host: host, Links: s.links, URLs: len(s.urls), Files: len(s.files)})
+	}
+	slices.SortFunc(counts, func(a, b hostCount) int {
+		if a.Links != b.Links {
+			return b.Links - a.Links
+		}
+		return strings.Compare(a.Host, b.Host)
+	})
+	return counts
+}
+
+// writeLinkInventory writes entries and their per-host counts to w in format (table, csv or json).
+func writeLinkInventory(w io.Writer, format string, entries []linkEntry) error {
+	hosts := countHosts(entries)
+	switch format {
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "FILE\tLINE\tURL\tRULE")
+		for _, entry := range entries {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", entry.File, entry.Line, entry.URL, entry.Rule)
+		}
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "HOST\tLINKS\tURLS\tFILES")
+		for _, host := range hosts {
+			fmt.Fprintf(tw, "%s\t%d\t%d\t%d\n", host.Host, host.Links, host.URLs, host.Files)
+		}
+		return tw.Flush()
+	case "csv":
+		// Both record kinds share one header; the first column tells them apart.
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"kind", "file", "line", "url", "rule", "host", "links", "urls", "files"})
+		for _, entry := range entries {
+			cw.Write([]string{"link", entry.File, strconv.Itoa(entry.Line), entry.URL, entry.Rule, "", "", "", ""})
+		}
+		for _, host := range hosts {
+			cw.Write([]string{"host", "", "", "", "", host.Host, strconv.Itoa(host.Links), strconv.Itoa(host.URLs), strconv.Itoa(host.Files)})
+		}
+		cw.Flush()
+		return cw.Error()
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(linkInventory{Links: entries, Hosts: hosts})
+	default:
+		return fmt.Errorf("unknown format: %s (expected table, csv or json)", format)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestListLinks(t *testing.T) {
+	config := &Config{
+		TextFileExtensions: []string{".md"},
+		Ignores: []Ignore{
+			{URL: "https://example.com/flaky", Codes: []int{200, 404}, Reason: "flaky", ConsideredAlternatives: []string{"none"}},
+		},
+		PrefixIgnores: []PrefixIgnore{
+			{Prefix: "https://x.com/", Reason: "X.com links are ignored"},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	readFile := getReadFileMock([]readFileEntry{
+		{"a.md", "https://x.com/user123\nhttps://example.com/flaky\n"},
+		{"b.md", "https://example.com/flaky\nhttps://github.com/koba-e964\n"},
+	})
+	entries, err := listLinks([]string{"a.md", "b.md"}, config, readFile)
+	if err != nil {
+		t.Fatalf("listLinks() error = %v, want nil", err)
+	}
+	expected := []linkEntry{
+		{File: "a.md", Line: 1, URL: "https://x.com/user123", Rule: "prefix_ignores[0] (skip)", skipped: true},
+		{File: "a.md", Line: 2, URL: "https://example.com/flaky", Rule: "ignores[0] (codes [200 404])"},
+		{File: "b.md", Line: 1, URL: "https://example.com/flaky", Rule: "ignores[0] (codes [200 404])"},
+		{File: "b.md", Line: 2, URL: "https://github.com/koba-e964", Rule: "default (2xx)"},
+	}
+	if !reflect.DeepEqual(entries, expected) {
+		t.Errorf("listLinks() = %v, want %v", entries, expected)
+	}
+
+	expectedHosts := []hostCount{
+		{Host: "example.com", Links: 2, URLs: 1, Files: 2},
+		{Host: "github.com", Links: 1, URLs: 1, Files: 1},
+		{Host: "x.com", Links: 1, URLs: 1, Files: 1},
+	}
+	if hosts := countHosts(entries); !reflect.DeepEqual(hosts, expectedHosts) {
+		t.Errorf("countHosts() = %v, want %v", hosts, expectedHosts)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+)
+
+// lockReferences returns, for each URI, the files in entries that link to it, sorted and without duplicates.
+func lockReferences(entries []linkEntry) map[string][]string {
+	references := map[string][]string{}
+	for _, entry := range entries {
+		if !slices.Contains(references[entry.URL], entry.File) {
+			references[entry.URL] = append(references[entry.URL], entry.File)
+		}
+	}
+	for _, files := range references {
+		slices.Sort(files)
+	}
+	return references
+}
+
+// writeLockList writes the entries of lockFile together with the files that link to them.
+func writeLockList(w io.Writer, lockFile *LockFile, references map[string][]string) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "URI\tHASH\tFILES\n")
+	for _, lock := range lockFile.Locks {
+		files := "(none)"
+		if len(references[lock.URI]) > 0 {
+			files = strings.Join(references[lock.URI], ", ")
+		}
+		fmt.Fprintf(tw, "%s\t%s:%s\t%s\n", lock.URI, lock.HashVersion, lock.shortHashes(), files)
+	}
+	return tw.Flush()
+}
+
+// shortHash abbreviates hash for display.
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+// lockChange is the result of updating a lock entry.
+type lockChange struct {
+	URI string
+	// accepted hashes, as Lock.shortHashes formats them
+	OldHash string
+	NewHash string
+	Err     error
+}
+
+func (c lockChange) String() string {
+	switch {
+	case c.Err != nil:
+		return fmt.Sprintf("%s: failed: %v", c.URI, c.Err)
+	case c.OldHash == c.NewHash:
+		return fmt.Sprintf("%s: unchanged", c.URI)
+	default:
+		return fmt.Sprintf("%s: changed: %s -> %s", c.URI, c.OldHash, c.NewHash)
+	}
+}
+
+// updateLockEntries refetches the entries of uris (all entries if uris is empty) and updates their hashes,
+// storing snapshots if settings.snapshotDir is not empty.
+// Entries that fail to be fetched are left as is, and the failures are reported in the changes.
+func updateLockEntries(ctx context.Context, lockFile *LockFile, uris []string, settings lockSettings) ([]lockChange, error) {
+	if len(uris) == 0 {
+		for _, lock := range lockFile.Locks {
+			uris = append(uris, lock.URI)
+		}
+	}
+	for _, uri := range uris {
+		if findLock(lockFile, uri) == nil {
+			return nil, fmt.Errorf("URI %s does not exist in lock file", uri)
+		}
+	}
+	changes := []lockChange{}
+	for _, uri := range uris {
+		lock := *findLock(lockFile, uri)
+		change := lockChange{URI: uri, OldHash: lock.shortHashes()}
+		if _, err := addLockEntryPure(ctx, lockFile, lock, "", true, settings); err != nil {
+			change.Err = err
+		}
+		change.NewHash = findLock(lockFile, uri).shortHashes()
+		changes = append(changes, change)
+	}
+	return changes, nil
+}
+
+// appendLockHash adds the hash of the current content of uri, in algorithm (that of the entry if empty),
+// to the accepted hashes of its entry, unless an accepted hash (of algorithm if given) already matches.
+// added reports whether it was added.
+func appendLockHash(ctx context.Context, lockFile *LockFile, uri string, algorithm string, settings lockSettings) (added bool, err error) {
+	lock := findLock(lockFile, uri)
+	if lock == nil {
+		return false, fmt.Errorf("URI %s does not exist in lock file", uri)
+	}
+	if err := lock.validate(); err != nil {
+		return false, err
+	}
+	requested := algorithm
+	if algorithm == "" {
+		algorithm = lock.algorithm()
+	}
+	if hashAlgorithms[algorithm] == nil {
+		return false, fmt.Errorf("unsupported hash algorithm: %q", algorithm)
+	}
+	content, err := fetchLockContent(ctx, uri, settings.timeout(uri), settings.maxContentLength, lock.HashVersion != "h1")
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch URL and compute hash: %w", err)
+	}
+	hashes, text, err := hashLockContent(*lock, content)
+	if err != nil {
+		return false, fmt.Errorf("failed to fetch URL and compute hash: %w", err)
+	}
+	if len(lock.matchingHashes(hashes, requested)) > 0 {
+		return false, nil
+	}
+	variant := *lock
+	variant.setHash(algorithm, hashes[algorithm])
+	if settings.snapshotDir != "" {
+		if err := writeSnapshot(settings.snapshotDir, variant, text); err != nil {
+			return false, fmt.Errorf("failed to write snapshot: %w", err)
+		}
+	}
+	lock.Hashes = append(lock.Hashes, LockHash{Algorithm: algorithm, Hash: hashes[algorithm]})
+	return true, nil
+}
+
+// findLock returns the entry of uri in lockFile, or nil.
+func findLock(lockFile *LockFile, uri string) *Lock {
+	for i := range lockFile.Locks {
+		if lockFile.Locks[i].URI == uri {
+			return &lockFile.Locks[i]
+		}
+	}
+	return nil
+}
+
+// removeLockEntries removes the entries of uris from lockFile. All of them must exist.
+func removeLockEntries(lockFile *LockFile, uris []string) error {
+	for _, uri := range uris {
+		if findLock(lockFile, uri) == nil {
+			return fmt.Errorf("URI %s does not exist in lock file", uri)
+		}
+	}
+	lockFile.Locks = slices.DeleteFunc(lockFile.Locks, func(lock Lock) bool {
+		return slices.Contains(uris, lock.URI)
+	})
+	return nil
+}
+
+// pruneLockEntries removes the entries whose URI no file links to, and returns their URIs.
+func pruneLockEntries(lockFile *LockFile, references map[string][]string) []string {
+	removed := []string{}
+	lockFile.Locks = slices.DeleteFunc(lockFile.Locks, func(lock Lock) bool {
+		if len(references[lock.URI]) == 0 {
+			removed = append(removed, lock.URI)
+			return true
+		}
+		return false
+	})
+	return removed
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+)
+
+// Supported values of Lock.HashVersion
+var hashVersions = []string{"h1", "h2"}
+
+// Supported algorithms of accepted hashes
+var hashAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// The algorithm of hash_of_content
+const defaultHashAlgorithm = "sha384"
+
+// acceptedHashes returns hash_of_content and the other accepted hashes of l.
+func (l Lock) acceptedHashes() []LockHash {
+	hashes := []LockHash{}
+	if l.HashOfContent != "" {
+		hashes = append(hashes, LockHash{Algorithm: defaultHashAlgorithm, Hash: l.HashOfContent})
+	}
+	return append(hashes, l.Hashes...)
+}
+
+// matchingHashes returns the accepted hashes of l found in hashes, which are hashes of the content by algorithm.
+// If algorithm is not empty, only the accepted hashes of algorithm are compared.
+func (l Lock) matchingHashes(hashes map[string]string, algorithm string) []LockHash {
+	var matching []LockHash
+	for _, h := range l.acceptedHashes() {
+		if (algorithm == "" || h.Algorithm == algorithm) && hashes[h.Algorithm] == h.Hash {
+			matching = append(matching, h)
+		}
+	}
+	return matching
+}
+
+// algorithm returns the algorithm to hash the content of l with when it is added or updated:
+// SHA-384 if l has hash_of_content or no other hash, and the algorithm of its first hash otherwise.
+func (l Lock) algorithm() string {
+	if l.HashOfContent != "" || len(l.Hashes) == 0 {
+		return defaultHashAlgorithm
+	}
+	return l.Hashes[0].Algorithm
+}
+
+// setHash replaces the accepted hashes of l with hash computed with algorithm.
+func (l *Lock) setHash(algorithm string, hash string) {
+	if algorithm == defaultHashAlgorithm {
+		l.HashOfContent, l.Hashes = hash, nil
+	} else {
+		l.HashOfContent, l.Hashes = "", []LockHash{{Algorithm: algorithm, Hash: hash}}
+	}
+}
+
+// shortHashes abbreviates the accepted hashes of l for display, tagging those not in SHA-384 with their algorithm.
+func (l Lock) shortHashes() string {
+	hashes := []string{}
+	for _, h := range l.acceptedHashes() {
+		if h.Algorithm == defaultHashAlgorithm {
+			hashes = append(hashes, shortHash(h.Hash))
+		} else {
+			hashes = append(hashes, h.Algorithm+":"+shortHash(h.Hash))
+		}
+	}
+	return strings.Join(hashes, ",")
+}
+
+func (h LockHash) String() string {
+	return h.Algorithm + ":" + h.Hash
+}
+
+// hashAll returns the hex hash of data in each of hashAlgorithms.
+func hashAll(data []byte) map[string]string {
+	hashes := map[string]string{}
+	for algorithm, newHash := range hashAlgorithms {
+		hasher := newHash()
+		hasher.Write(data)
+		hashes[algorithm] = hex.EncodeToString(hasher.Sum(nil))
+	}
+	return hashes
+}
+
+// normalizes reports whether l has settings that only h2 supports.
+func (l Lock) normalizes() bool {
+	return len(l.ExcludeRegexes) > 0 || len(l.ExcludeSelectors) > 0 || l.Selector != "" || len(l.TextBetween) > 0
+}
+
+// validate checks the hash version, the exclusions and the region of l.
+func (l Lock) validate() error {
+	switch l.HashVersion {
+	case "h1":
+		if l.normalizes() {
+			return fmt.Errorf("%s: exclusions, selector and text_between require hash_version = \"h2\"", l.URI)
+		}
+	case "h2":
+	default:
+		return fmt.Errorf("unsupported hash version: %s", l.HashVersion)
+	}
+	var errs []error
+	for _, h := range l.Hashes {
+		if hashAlgorithms[h.Algorithm] == nil {
+			errs = append(errs, fmt.Errorf("%s: unsupported hash algorithm: %q (expected one of %s)",
+				l.URI, h.Algorithm, strings.Join(slices.Sorted(maps.Keys(hashAlgorithms)), ", ")))
+		}
+	}
+	for _, pattern := range l.ExcludeRegexes {
+		if _, err := regexp.Compile(pattern); err != nil {
+			errs = append(errs, fmt.Errorf("%s: exclude_regexes: %w", l.URI, err))
+		}
+	}
+	for _, selector := range l.ExcludeSelectors {
+		if _, err := parseSelector(selector); err != nil {
+			errs = append(errs, fmt.Errorf("%s: exclude_selectors: %w", l.URI, err))
+		}
+	}
+	if l.Selector != "" {
+		if _, err := parseRegionSelector(l.Selector); err != nil {
+			errs = append(errs, fmt.Errorf("%s: selector: %w", l.URI, err))
+		}
+	}
+	if len(l.TextBetween) > 0 && (len(l.TextBetween) != 2 || l.TextBetween[0] == "" || l.TextBetween[1] == "") {
+		errs = append(errs, fmt.Errorf("%s: text_between must be two non-empty markers, got %q", l.URI, l.TextBetween))
+	}
+	return errors.Join(errs...)
+}
+
+// regionSelector selects the elements of a page to be hashed.
+type regionSelector interface {
+	selectNodes(root *html.Node) []*html.Node
+}
+
+// parseRegionSelector parses s as an XPath if it starts with /, and as a CSS selector otherwise.
+func parseRegionSelector(s string) (regionSelector, error) {
+	if strings.HasPrefix(s, "/") {
+		return parseXPath(s)
+	}
+	return parseSelector(s)
+}
+
+// hashLockContent hashes content as lock.HashVersion specifies, in each of hashAlgorithms.
+// text is the text of the content, stored as a snapshot and compared on mismatch: the hashed text for h2,
+// and the normalized text (or a summary of binary or large content) for h1. lock must be valid, and content must
+// be fetched with the whole body for h2.
+func hashLockContent(lock Lock, content *fetchedContent) (hashes map[string]string, text string, err error) {
+	if lock.HashVersion == "h1" {
+		if isTextContentType(content.contentType) && !content.partial {
+			// No selector is given, so normalization does not fail
+			text, _ = normalizeContent(content.body, content.contentType, Lock{})
+		} else {
+			text = fmt.Sprintf("(%d bytes of %s)", content.length, content.contentType)
+		}
+		return content.hashes, text, nil
+	}
+	text, err = normalizeContent(content.body, content.contentType, lock)
+	if err != nil {
+		return nil, "", err
+	}
+	return hashAll([]byte(text)), text, nil
+}
+
+// isTextContentType reports whether a media type is text that can be shown in a diff.
+func isTextContentType(contentType string) bool {
+	contentType = strings.ToLower(contentType)
+	if strings.HasPrefix(contentType, "text/") {
+		return true
+	}
+	for _, s := range []string{"html", "xml", "json", "javascript"} {
+		if strings.Contains(contentType, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// Bodies longer than this are not kept in memory for h1 snapshots
+const maxSnapshotBodyLength = 1024 * 1024
+
+// errContentTooLong is returned when the content is longer than the limit.
+var errContentTooLong = errors.New("content is longer than max_lock_content_length")
+
+// fetchedContent is the content of a locked URL.
+type fetchedContent struct {
+	// media type, from Content-Type or sniffed
+	contentType string
+	// number of bytes
+	length int64
+	// hex hashes of the whole content by algorithm
+	hashes map[string]string
+	// the content, or only its first maxSnapshotBodyLength bytes if partial
+	body    []byte
+	partial bool
+}
+
+// fetchLockContent fetches the content of a URL, failing if it is longer than limit bytes or shorter than
+// its Content-Length. The content is hashed as it is read; unless wholeBody, only its beginning is kept in memory.
+func fetchLockContent(ctx context.Context, url string, timeout time.Duration, limit int64, wholeBody bool) (*fetchedContent, error) {
+	resp, err := getLockURL(ctx, url, timeout)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("%w: Content-Length is %d bytes, and the limit is %d", errContentTooLong, resp.ContentLength, limit)
+	}
+	body := &prefixBuffer{limit: maxSnapshotBodyLength}
+	if wholeBody {
+		body.limit = limit
+	}
+	hashers := map[string]hash.Hash{}
+	writers := []io.Writer{body}
+	for algorithm, newHash := range hashAlgorithms {
+		hashers[algorithm] = newHash()
+		writers = append(writers, hashers[algorithm])
+	}
+	// One byte more than limit tells if the content is longer
+	n, err := io.Copy(io.MultiWriter(writers...), io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", errContentTooLong, limit)
+	}
+	if resp.ContentLength >= 0 && n != resp.ContentLength {
+		return nil, fmt.Errorf("truncated content: got %d of %d bytes", n, resp.ContentLength)
+	}
+	content := &fetchedContent{
+		contentType: resp.Header.Get("Content-Type"),
+		length:      n,
+		hashes:      map[string]string{},
+		body:        body.Bytes(),
+		partial:     body.overflowed,
+	}
+	for algorithm, hasher := range hashers {
+		content.hashes[algorithm] = hex.EncodeToString(hasher.Sum(nil))
+	}
+	if content.contentType == "" {
+		content.contentType = http.DetectContentType(content.body)
+	}
+	return content, nil
+}
+
+// prefixBuffer keeps the first limit bytes written to it, and discards the rest.
+type prefixBuffer struct {
+	bytes.Buffer
+	limit      int64
+	overflowed bool
+}
+
+func (b *prefixBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - int64(b.Len()); int64(len(p)) > room {
+		b.overflowed = true
+		b.Buffer.Write(p[:max(room, 0)])
+		return len(p), nil
+	}
+	return b.Buffer.Write(p)
+}
+
+// normalizeContent returns the text hashed by h2.
+// For HTML, it is the visible text of the elements selected by lock.Selector (the whole page if it is empty),
+// without the elements matching lock.ExcludeSelectors, one line per block; otherwise, it is the content as text.
+// Whitespace is collapsed and empty lines are removed. Then the text is cut to lock.TextBetween if given,
+// the matches of lock.ExcludeRegexes are removed (in order), and whitespace is collapsed again.
+func normalizeContent(content []byte, contentType string, lock Lock) (string, error) {
+	text := string(content)
+	if strings.Contains(strings.ToLower(contentType), "html") {
+		excluded := cssSelector{}
+		for _, s := range lock.ExcludeSelectors {
+			// validated in Lock.validate
+			selector, _ := parseSelector(s)
+			excluded = excluded.union(selector)
+		}
+		nodes := []*html.Node{parseHTML(text)}
+		if lock.Selector != "" {
+			selector, _ := parseRegionSelector(lock.Selector)
+			if nodes = selector.selectNodes(nodes[0]); len(nodes) == 0 {
+				return "", fmt.Errorf("selector %q matches nothing", lock.Selector)
+			}
+		}
+		texts := []string{}
+		for _, n := range nodes {
+			texts = append(texts, visibleText(n, excluded.matches))
+		}
+		text = strings.Join(texts, "\n")
+	} else if lock.Selector != "" {
+		return "", fmt.Errorf("selector %q requires HTML, but the content is %s", lock.Selector, contentType)
+	}
+	text = collapseWhitespace(text)
+	if len(lock.TextBetween) == 2 {
+		start, end := lock.TextBetween[0], lock.TextBetween[1]
+		i := strings.Index(text, start)
+		if i < 0 {
+			return "", fmt.Errorf("text_between: start marker %q is not found", start)
+		}
+		text = text[i+len(start):]
+		j := strings.Index(text, end)
+		if j < 0 {
+			return "", fmt.Errorf("text_between: end marker %q is not found after the start marker", end)
+		}
+		text = text[:j]
+	}
+	for _, pattern := range lock.ExcludeRegexes {
+		text = regexp.MustCompile(pattern).ReplaceAllString(text, "")
+	}
+	return collapseWhitespace(text), nil
+}
+
+// collapseWhitespace replaces each run of whitespace in a line with a space, trims lines and removes empty ones.
+func collapseWhitespace(text string) string {
+	lines := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.Join(strings.Fields(line), " "); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeContent(t *testing.T) {
+	page := `<!DOCTYPE html>
+<html><head><title>Spec</title><script>var csrf = "<p>abc</p>";</script></head>
+<body>
+  <nav class="site-nav"><a href="/">Home</a></nav>
+  <h1>RFC&nbsp;9999</h1>
+  <p>Generated   at <span id=ts>12:34:56</span>.
+  <p>Second <b>para</b>graph<br>next line
+  <ul><li>one<li>two</ul>
+  <div hidden>secret</div>
+  <!-- <p>comment</p> -->
+  <footer><div class="ad banner">Buy now</div>&copy; 2024</footer>
+</body></html>`
+	tests := []struct {
+		lock Lock
+		want string
+	}{
+		{Lock{}, "Home\nRFC 9999\nGenerated at 12:34:56.\nSecond paragraph\nnext line\none\ntwo\nBuy now\n© 2024"},
+		{Lock{ExcludeSelectors: []string{"nav", "footer > .ad", "#ts"}}, "RFC 9999\nGenerated at .\nSecond paragraph\nnext line\none\ntwo\n© 2024"},
+		{Lock{ExcludeSelectors: []string{"body div[class~=banner], [href^='/']"}, ExcludeRegexes: []string{`\d+:\d+:\d+`, `(?m)^two$`}},
+			"RFC 9999\nGenerated at .\nSecond paragraph\nnext line\none\n© 2024"},
+	}
+	for _, test := range tests {
+		if got, err := normalizeContent([]byte(page), "text/html; charset=utf-8", test.lock); err != nil || got != test.want {
+			t.Errorf("normalizeContent(%v) = %q, %v, want %q", test.lock, got, err, test.want)
+		}
+	}
+
+	// Other content is hashed as text
+	if got, _ := normalizeContent([]byte("a  <b>\r\n\n  c\t"), "text/plain", Lock{}); got != "a <b>\nc" {
+		t.Errorf("normalizeContent() = %q, want %q", got, "a <b>\nc")
+	}
+}
+
+func TestValidateLock(t *testing.T) {
+	tests := []struct {
+		lock    Lock
+		wantErr string
+	}{
+		{Lock{URI: "u", HashVersion: "h1"}, ""},
+		{Lock{URI: "u", HashVersion: "h2", ExcludeRegexes: []string{"a+"}, ExcludeSelectors: []string{"div.x > p"}}, ""},
+		{Lock{URI: "u", HashVersion: "h0"}, "unsupported hash version: h0"},
+		{Lock{URI: "u", HashVersion: "h1", ExcludeRegexes: []string{"a+"}}, `require hash_version = "h2"`},
+		{Lock{URI: "u", HashVersion: "h2", ExcludeRegexes: []string{"("}}, "exclude_regexes"},
+		{Lock{URI: "u", HashVersion: "h2", ExcludeSelectors: []string{"a:nosuch"}}, "unknown pseudoclass"},
+		{Lock{URI: "u", HashVersion: "h2", ExcludeSelectors: []string{"a["}}, "expected identifier"},
+		{Lock{URI: "u", HashVersion: "h2", ExcludeSelectors: []string{"a,"}}, "expected selector"},
+		{Lock{URI: "u", HashVersion: "h2", Selector: "//table[@id='x']/tr[1]", TextBetween: []string{"a", "b"}}, ""},
+		{Lock{URI: "u", HashVersion: "h1", Selector: "table"}, `require hash_version = "h2"`},
+		{Lock{URI: "u", HashVersion: "h2", Selector: "//table[0]"}, "positions start at 1"},
+		{Lock{URI: "u", HashVersion: "h2", Selector: "/table/"}, "expected a tag name"},
+		{Lock{URI: "u", HashVersion: "h2", TextBetween: []string{"a"}}, "two non-empty markers"},
+		{Lock{URI: "u", HashVersion: "h1", Hashes: []LockHash{{Algorithm: "sha256"}, {Algorithm: "md5"}}}, `unsupported hash algorithm: "md5"`},
+	}
+	for _, test := range tests {
+		err := test.lock.validate()
+		if test.wantErr == "" && err != nil {
+			t.Errorf("validate(%v) error = %v, want nil", test.lock, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("validate(%v) error = %v, want to contain %q", test.lock, err, test.wantErr)
+		}
+	}
+}
+
+func TestNormalizeContentRegion(t *testing.T) {
+	page := `<html><body><h1>Registry</h1>
+<table id="codes"><tr><th>Code<th>Meaning
+<tr><td>1<td>one
+<tr><td>2<td>two</table>
+<table id="other"><tr><td>x</table>
+<div class="note">Section 3. Values. Section 4.</div>
+</body></html>`
+	tests := []struct {
+		lock    Lock
+		want    string
+		wantErr string
+	}{
+		{lock: Lock{Selector: "#codes"}, want: "Code\nMeaning\n1\none\n2\ntwo"},
+		{lock: Lock{Selector: "table tr > td"}, want: "1\none\n2\ntwo\nx"},
+		// Rows are in the tbody that the HTML5 parser implies
+		{lock: Lock{Selector: "//table[@id='codes']/tbody/tr[3]"}, want: "2\ntwo"},
+		{lock: Lock{Selector: "//table[@id='codes']/tr"}, wantErr: "matches nothing"},
+		{lock: Lock{Selector: "#codes tr:nth-child(3)"}, want: "2\ntwo"},
+		{lock: Lock{Selector: "/html/body/table[2]//td"}, want: "x"},
+		{lock: Lock{Selector: "//*[@class]"}, want: "Section 3. Values. Section 4."},
+		{lock: Lock{TextBetween: []string{"Section 3.", "Section 4."}}, want: "Values."},
+		{lock: Lock{Selector: "div.note", TextBetween: []string{"Section 3.", "Section 4."}, ExcludeRegexes: []string{"s"}}, want: "Value."},
+		{lock: Lock{Selector: "#missing"}, wantErr: "matches nothing"},
+		{lock: Lock{TextBetween: []string{"Section 5.", "Section 4."}}, wantErr: "start marker"},
+		{lock: Lock{TextBetween: []string{"Section 4.", "Section 3."}}, wantErr: "end marker"},
+	}
+	for _, test := range tests {
+		got, err := normalizeContent([]byte(page), "text/html", test.lock)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("normalizeContent(%v) error = %v, want to contain %q", test.lock, err, test.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("normalizeContent(%v) = %q, %v, want %q", test.lock, got, err, test.want)
+		}
+	}
+
+	if _, err := normalizeContent([]byte("plain"), "text/plain", Lock{Selector: "p"}); err == nil {
+		t.Errorf("normalizeContent() error = nil, want an error for a selector on text/plain")
+	}
+}
+
+func TestFetchLockContent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chunked":
+			// No Content-Length, so the limit is only noticed while reading
+			w.Write([]byte(strings.Repeat("a", 60)))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(strings.Repeat("a", 60)))
+		case "/truncated":
+			w.Header().Set("Content-Length", "100")
+			w.Write([]byte("short"))
+		default:
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte(strings.Repeat("a", 100)))
+		}
+	}))
+	defer server.Close()
+
+	content, err := fetchLockContent(context.Background(), server.URL+"/ok", 0, 100, false)
+	if err != nil {
+		t.Fatalf("fetchLockContent() error = %v", err)
+	}
+	sum := sha512.Sum384([]byte(strings.Repeat("a", 100)))
+	if content.length != 100 || content.hashes["sha384"] != hex.EncodeToString(sum[:]) || content.partial {
+		t.Errorf("fetchLockContent() = %+v, want 100 bytes of a", content)
+	}
+	for _, path := range []string{"/ok", "/chunked"} {
+		if _, err := fetchLockContent(context.Background(), server.URL+path, 0, 99, false); !errors.Is(err, errContentTooLong) {
+			t.Errorf("fetchLockContent(%s) error = %v, want errContentTooLong", path, err)
+		}
+	}
+	if _, err := fetchLockContent(context.Background(), server.URL+"/truncated", 0, 100, false); err == nil {
+		t.Errorf("fetchLockContent(/truncated) error = nil, want an error")
+	}
+}
+
+func TestContentLength(t *testing.T) {
+	body := "version 1"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+
+	settings := (&Config{}).lockSettings()
+	lockFile, err := addLockEntryPure(context.Background(), &LockFile{}, Lock{URI: server.URL}, "", false, settings)
+	if err != nil {
+		t.Fatalf("addLockEntryPure() error = %v", err)
+	}
+	if got := lockFile.Locks[0].ContentLength; got != 9 {
+		t.Errorf("ContentLength = %d, want 9", got)
+	}
+	body = "version 10"
+	err = verifyLockEntry(context.Background(), lockFile.Locks[0], settings)
+	if err == nil || !strings.Contains(err.Error(), "length changed from 9 to 10 bytes") {
+		t.Errorf("verifyLockEntry() error = %v, want the change of length", err)
+	}
+	settings.maxContentLength = 5
+	err = verifyLockEntry(context.Background(), lockFile.Locks[0], settings)
+	if !errors.Is(err, errContentTooLong) {
+		t.Errorf("verifyLockEntry() error = %v, want errContentTooLong", err)
+	}
+}
+
+func TestAcceptedHashes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "content")
+	}))
+	defer server.Close()
+	settings := (&Config{}).lockSettings()
+	hashes := hashAll([]byte("content"))
+
+	lockFile, err := addLockEntryPure(context.Background(), &LockFile{}, Lock{URI: server.URL}, "sha256", false, settings)
+	if err != nil {
+		t.Fatalf("addLockEntryPure() error = %v", err)
+	}
+	want := []LockHash{{Algorithm: "sha256", Hash: hashes["sha256"]}}
+	if lock := lockFile.Locks[0]; lock.HashOfContent != "" || !slices.Equal(lock.Hashes, want) {
+		t.Errorf("addLockEntryPure() = %+v, want only %v", lock, want)
+	}
+	// Written as [[locks.hashes]]
+	lockPath := filepath.Join(t.TempDir(), "test.lock")
+	if err := writeLockFile(lockPath, lockFile); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readLockFile(lockPath)
+	if err != nil || !slices.Equal(read.Locks[0].Hashes, want) {
+		t.Errorf("readLockFile() = %+v, %v, want hashes %v", read, err, want)
+	}
+
+	// On unchanged content, an explicit algorithm is compared only with the hashes in it
+	added, err := appendLockHash(context.Background(), lockFile, server.URL, "sha512", settings)
+	want = []LockHash{{Algorithm: "sha256", Hash: hashes["sha256"]}, {Algorithm: "sha512", Hash: hashes["sha512"]}}
+	if err != nil || !added || !slices.Equal(lockFile.Locks[0].Hashes, want) {
+		t.Errorf("appendLockHash(sha512) = %v, %v, hashes %v, want added %v", added, err, lockFile.Locks[0].Hashes, want)
+	}
+	lockFile, err = addLockEntryPure(context.Background(), lockFile, Lock{URI: server.URL}, "sha384", true, settings)
+	if err != nil {
+		t.Fatalf("addLockEntryPure(sha384) error = %v", err)
+	}
+	if lock := lockFile.Locks[0]; lock.HashOfContent != hashes["sha384"] || lock.Hashes != nil {
+		t.Errorf("addLockEntryPure(sha384) = %+v, want only the SHA-384 hash", lock)
+	}
+
+	tests := []struct {
+		lock    Lock
+		wantErr string
+	}{
+		{Lock{HashOfContent: hashes["sha384"]}, ""},
+		{Lock{HashOfContent: "other", Hashes: []LockHash{{Algorithm: "sha512", Hash: hashes["sha512"]}}}, ""},
+		{Lock{Hashes: []LockHash{{Algorithm: "sha256", Hash: "a"}, {Algorithm: "sha256", Hash: "b"}}},
+			"expected sha256:a or sha256:b, got sha256:" + hashes["sha256"]},
+		{Lock{}, "no hash"},
+	}
+	for _, test := range tests {
+		test.lock.URI, test.lock.HashVersion = server.URL, "h1"
+		err := verifyLockEntry(context.Background(), test.lock, settings)
+		if test.wantErr == "" && err != nil {
+			t.Errorf("verifyLockEntry(%v) error = %v, want nil", test.lock, err)
+		}
+		if test.wantErr != "" && (err == nil || !strings.Contains(err.Error(), test.wantErr)) {
+			t.Errorf("verifyLockEntry(%v) error = %v, want to contain %q", test.lock, err, test.wantErr)
+		}
+	}
+}
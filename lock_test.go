@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLockListRemovePrune(t *testing.T) {
+	newLockFile := func() *LockFile {
+		return &LockFile{Locks: []Lock{
+			{URI: "https://example.com/a", HashVersion: "h1", HashOfContent: "0123456789abcdef"},
+			{URI: "https://example.com/b", HashVersion: "h1", HashOfContent: "fedcba"},
+			{URI: "https://example.com/c", HashVersion: "h1", HashOfContent: "abc"},
+		}}
+	}
+	references := lockReferences([]linkEntry{
+		{File: "docs/b.md", Line: 1, URL: "https://example.com/a"},
+		{File: "README.md", Line: 3, URL: "https://example.com/a"},
+		{File: "README.md", Line: 9, URL: "https://example.com/a"},
+		{File: "README.md", Line: 4, URL: "https://example.com/c"},
+	})
+	if got, want := references["https://example.com/a"], []string{"README.md", "docs/b.md"}; !slices.Equal(got, want) {
+		t.Errorf("references = %v, want %v", got, want)
+	}
+
+	var b strings.Builder
+	if err := writeLockList(&b, newLockFile(), references); err != nil {
+		t.Fatalf("writeLockList() error = %v, want nil", err)
+	}
+	for _, want := range []string{
+		"https://example.com/a  h1:0123456789ab  README.md, docs/b.md",
+		"https://example.com/b  h1:fedcba        (none)",
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("writeLockList() = %s, want to contain %q", b.String(), want)
+		}
+	}
+
+	lockFile := newLockFile()
+	if err := removeLockEntries(lockFile, []string{"https://example.com/a", "https://example.com/x"}); err == nil {
+		t.Errorf("removeLockEntries() error = nil, want an error for a URI that is not locked")
+	}
+	if len(lockFile.Locks) != 3 {
+		t.Errorf("len(Locks) = %d, want 3 after a failed removal", len(lockFile.Locks))
+	}
+	if err := removeLockEntries(lockFile, []string{"https://example.com/a", "https://example.com/c"}); err != nil {
+		t.Errorf("removeLockEntries() error = %v, want nil", err)
+	}
+	if len(lockFile.Locks) != 1 || lockFile.Locks[0].URI != "https://example.com/b" {
+		t.Errorf("Locks = %v, want only https://example.com/b", lockFile.Locks)
+	}
+
+	lockFile = newLockFile()
+	if got, want := pruneLockEntries(lockFile, references), []string{"https://example.com/b"}; !slices.Equal(got, want) {
+		t.Errorf("pruneLockEntries() = %v, want %v", got, want)
+	}
+	if len(lockFile.Locks) != 2 {
+		t.Errorf("len(Locks) = %d, want 2", len(lockFile.Locks))
+	}
+
+	if _, err := updateLockEntries(context.Background(), newLockFile(), []string{"https://example.com/x"}, (&Config{}).lockSettings()); err == nil {
+		t.Errorf("updateLockEntries() error = nil, want an error for a URI that is not locked")
+	}
+}
+
+func TestUpdateAndAppendAcceptedHashes(t *testing.T) {
+	body := "variant A"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, body)
+	}))
+	defer server.Close()
+	settings := (&Config{}).lockSettings()
+	a, b := hashAll([]byte("variant A")), hashAll([]byte("variant B"))
+	variants := []LockHash{{Algorithm: "sha256", Hash: a["sha256"]}, {Algorithm: "sha256", Hash: b["sha256"]}}
+	lockFile := &LockFile{Locks: []Lock{{URI: server.URL, HashVersion: "h1", Hashes: variants}}}
+
+	// Content matching one of the variants keeps all of them
+	changes, err := updateLockEntries(context.Background(), lockFile, nil, settings)
+	if err != nil || len(changes) != 1 || changes[0].String() != server.URL+": unchanged" {
+		t.Errorf("updateLockEntries() = %v, %v, want unchanged", changes, err)
+	}
+	if !slices.Equal(lockFile.Locks[0].Hashes, variants) {
+		t.Errorf("Hashes = %v, want %v", lockFile.Locks[0].Hashes, variants)
+	}
+
+	// A new variant is added, and an accepted one is not added again
+	body = "variant C"
+	added, err := appendLockHash(context.Background(), lockFile, server.URL, "", settings)
+	want := append(slices.Clone(variants), LockHash{Algorithm: "sha256", Hash: hashAll([]byte("variant C"))["sha256"]})
+	if err != nil || !added || !slices.Equal(lockFile.Locks[0].Hashes, want) {
+		t.Errorf("appendLockHash() = %v, %v, hashes %v, want %v", added, err, lockFile.Locks[0].Hashes, want)
+	}
+	body = "variant B"
+	if added, err := appendLockHash(context.Background(), lockFile, server.URL, "sha256", settings); err != nil || added {
+		t.Errorf("appendLockHash() = %v, %v, want false, nil", added, err)
+	}
+	// An explicit algorithm is compared only with the accepted hashes of it
+	want = append(want, LockHash{Algorithm: "sha512", Hash: b["sha512"]})
+	if added, err := appendLockHash(context.Background(), lockFile, server.URL, "sha512", settings); err != nil || !added || !slices.Equal(lockFile.Locks[0].Hashes, want) {
+		t.Errorf("appendLockHash() = %v, %v, hashes %v, want %v", added, err, lockFile.Locks[0].Hashes, want)
+	}
+	if _, err := addLockEntryPure(context.Background(), lockFile, Lock{URI: server.URL}, "sha384", true, settings); err != nil {
+		t.Fatalf("addLockEntryPure() error = %v", err)
+	}
+	if lock := lockFile.Locks[0]; lock.HashOfContent != b["sha384"] || len(lock.Hashes) != 0 {
+		t.Errorf("addLockEntryPure() = %+v, want only the SHA-384 hash", lock)
+	}
+	lockFile.Locks[0].HashOfContent, lockFile.Locks[0].Hashes = "", variants
+	if _, err := appendLockHash(context.Background(), lockFile, server.URL+"/other", "", settings); err == nil {
+		t.Errorf("appendLockHash() error = nil, want an error for a URI that is not locked")
+	}
+
+	// Other content replaces all of them
+	body = "variant D"
+	changes, _ = updateLockEntries(context.Background(), lockFile, nil, settings)
+	if !strings.Contains(changes[0].String(), ": changed: ") || len(lockFile.Locks[0].Hashes) != 1 {
+		t.Errorf("updateLockEntries() = %v, hashes %v, want one new hash", changes, lockFile.Locks[0].Hashes)
+	}
+}
@@ -1,14 +1,13 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
 	"os"
-	"path/filepath"
 	"regexp"
-	"strings"
-	"time"
+	"sync"
 )
 
 var httpRegex = regexp.MustCompile("http://[-._%/[:alnum:]?:=+~@#&]+")
@@ -20,219 +19,115 @@ func stripTitleSuffix(url string) string {
 	return titleRegex.ReplaceAllString(url, "")
 }
 
-// shouldIgnoreByPrefix checks if a URL should be ignored based on prefix rules
-func shouldIgnoreByPrefix(url string, prefixIgnores []PrefixIgnore) *PrefixIgnore {
-	for i := range prefixIgnores {
-		if strings.HasPrefix(url, prefixIgnores[i].Prefix) {
-			return &prefixIgnores[i]
-		}
-	}
-	return nil
-}
-
-// If ignore != nil, ignore.Codes will be used instead of the 2xx criterion.
+// If rule != nil, rule's actions are used instead of a HEAD request with the 2xx criterion.
 // This function modifies seen.
-func checkURLLiveness(url string, retryCount int, ignore *Ignore, seen map[string]struct{}, httpHead HttpAccessor) error {
-	if _, ok := seen[url]; ok {
+func checkURLLiveness(ctx context.Context, url string, retryCount int, rule *Rule, seen *seenURLs, httpAccess HttpAccessor) error {
+	if !seen.add(seenKey(url, rule)) {
 		// Already checked: not checking again
 		return nil
 	}
-	seen[url] = struct{}{}
-	for i := 0; i < retryCount; i++ {
-		statusCode, err := httpHead(url)
+	return retry(ctx, retryCount, func() (bool, error) {
+		statusCode, err := httpAccess(rule.request(url))
 		if err != nil {
-			if ignore != nil && ignore.HasTLSError {
-				// ok, but because ignore != nil, we need a log
-				log.Printf("ok: url = %s, ignore = %v, err = %v\n", url, ignore, err)
-				return nil
+			if rule.acceptsError(err) {
+				// ok, but because rule != nil, we need a log
+				log.Printf("ok: url = %s, rule = %s, err = %v\n", url, rule.name(), err)
+				return false, nil
 			}
-			return err
+			return false, err
 		}
-		if ignore != nil {
-			ok := false
-			for _, code := range ignore.Codes {
-				if statusCode == code {
-					ok = true
-					break
-				}
+		if rule.acceptsStatus(statusCode) {
+			if rule != nil && len(rule.Codes) > 0 {
+				// ok, but because rule != nil, we need a log
+				log.Printf("ok: code = %d, url = %s , rule = %s\n", statusCode, url, rule.name())
 			}
-			if ok {
-				// ok, but because ignore != nil, we need a log
-				log.Printf("ok: code = %d, url = %s , ignore = %v\n", statusCode, url, ignore)
-				return nil
-			}
-		} else {
-			if statusCode/100 == 2 {
-				// ok
-				return nil
-			}
-		}
-		log.Printf("code = %d, url = %s, ignore = %v\n", statusCode, url, ignore)
-		if i == retryCount-1 {
-			return errors.New("invalid status code")
-		} else {
-			// exponential backoff
-			time.Sleep((1 << i) * time.Second)
+			return false, nil
 		}
+		log.Printf("code = %d, url = %s, rule = %s\n", statusCode, url, rule.name())
+		return true, &statusCodeError{StatusCode: statusCode}
+	})
+}
+
+// seenURLs records the URLs already checked, and may be shared by concurrent checks.
+type seenURLs struct {
+	mu   sync.Mutex
+	keys map[string]struct{}
+}
+
+func newSeenURLs() *seenURLs {
+	return &seenURLs{keys: map[string]struct{}{}}
+}
+
+// add records key, and reports whether it was not recorded yet.
+func (s *seenURLs) add(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.keys[key]; ok {
+		return false
+	}
+	s.keys[key] = struct{}{}
+	return true
+}
+
+// seenKey returns the key of seen for url checked under rule.
+// The same URL can be checked under different rules when rules are scoped by paths.
+func seenKey(url string, rule *Rule) string {
+	if rule == nil {
+		return url
 	}
-	return nil
+	return url + " " + rule.origin
 }
 
+// checkFile returns an error wrapping a *linkError for each link that is not alive, and an error for each invalid suppression.
+// Failures of links under a rule with severity = "warning" are only logged, and so are unused suppressions.
 // This function modifies seen.
-func checkFile(path string, retryCount int, ignores map[string]*Ignore, prefixIgnores []PrefixIgnore, seen map[string]struct{}, readFile FileReader, httpHead HttpAccessor) (err error) {
+func checkFile(ctx context.Context, path string, retryCount int, rules []Rule, seen *seenURLs, readFile FileReader, httpAccess HttpAccessor) (err error) {
 	content, err := readFile(path)
 	if err != nil {
 		return err
 	}
+	suppressions, errs := parseSuppressions(path, content)
 
-	all := httpRegex.FindAll(content, -1)
-	var livenessErrors uint64 = 0
-	for _, v := range all {
-		url := string(v)
-		url = stripTitleSuffix(url)
+	var livenessErrors []error
+	for _, link := range extractLinks(content) {
+		url := link.URL
 
-		// Check if URL matches any prefix ignore rules
-		if prefixIgnore := shouldIgnoreByPrefix(url, prefixIgnores); prefixIgnore != nil {
-			log.Printf("%s: HTTP link ignored by prefix: url = %s, prefix = %s, reason = %s\n",
-				path, url, prefixIgnore.Prefix, prefixIgnore.Reason)
+		if s := suppressionAt(link.Line, suppressions); s != nil {
+			log.Printf("%s:%d: link suppressed: url = %s, marker = %s:%d (%s), reason = %s\n",
+				path, link.Line, url, path, s.Line, s.Kind, s.Reason)
 			continue
 		}
 
-		ignore := ignores[url]
-		log.Printf("%s: HTTP link: url = %s\n", path, url)
-		if thisError := checkURLLiveness(url, retryCount, ignore, seen, httpHead); thisError != nil {
-			livenessErrors++
-			log.Printf("%s: not alive: url = %s , thiserror = %v\n", path, url, thisError)
-		}
-	}
-
-	all = httpsRegex.FindAll(content, -1)
-	for _, v := range all {
-		url := string(v)
-		url = stripTitleSuffix(url)
-
-		// Check if URL matches any prefix ignore rules
-		if prefixIgnore := shouldIgnoreByPrefix(url, prefixIgnores); prefixIgnore != nil {
-			log.Printf("%s: HTTPS link ignored by prefix: url = %s, prefix = %s, reason = %s\n",
-				path, url, prefixIgnore.Prefix, prefixIgnore.Reason)
+		rule := matchRule(url, path, rules)
+		if rule != nil && rule.Skip {
+			log.Printf("%s:%d: link ignored: url = %s, rule = %s, reason = %s\n",
+				path, link.Line, url, rule.matchString(path), rule.Reason)
 			continue
 		}
 
-		ignore := ignores[url]
-		if thisError := checkURLLiveness(url, retryCount, ignore, seen, httpHead); thisError != nil {
-			livenessErrors++
-			log.Printf("%s: not alive: url = %s , thiserror = %v\n", path, url, thisError)
-		}
-	}
-	if livenessErrors > 0 {
-		err = fmt.Errorf("liveness check failed: path = %s , prev error = %w", path, err)
-	}
-
-	return err
-}
-
-func main() {
-	// Check for add subcommand
-	if len(os.Args) >= 2 && os.Args[1] == "add" {
-		hasError := false
-		// parse options
-		force := false
-		urls := []string{}
-		for _, arg := range os.Args[2:] {
-			if arg == "--force" || arg == "-f" {
-				force = true
-			} else {
-				urls = append(urls, arg)
+		log.Printf("%s:%d: link: url = %s\n", path, link.Line, url)
+		if thisError := checkURLLiveness(ctx, url, retryCount, rule, seen, httpAccess); thisError != nil {
+			linkErr := &linkError{Path: path, Line: link.Line, URL: url, Err: thisError}
+			if rule.severity() == severityWarning {
+				log.Printf("warning: %v (rule = %s)\n", linkErr, rule.name())
+				continue
 			}
+			livenessErrors = append(livenessErrors, linkErr)
+			log.Printf("%v\n", linkErr)
 		}
-		if len(urls) == 0 {
-			log.Printf("Error: URL argument is required\n")
-			log.Printf("Usage: link-checker add [--force|-f] <URL>\n")
-			os.Exit(1)
-		}
-		for _, url := range urls {
-			if err := addLockEntry(lockFilePath, url, force); err != nil {
-				log.Printf("Error adding lock entry: %v\n", err)
-				hasError = true
-			} else {
-				log.Printf("Successfully added %s to lock file\n", url)
-			}
-		}
-		if hasError {
-			os.Exit(1)
-		}
-		return
-	}
-
-	config, err := readConfig(configFilePath)
-	if err != nil {
-		panic(err)
-	}
-	if err := config.Validate(); err != nil {
-		panic(err)
 	}
-	ignores := make(map[string]*Ignore)
-	for _, ignore := range config.Ignores {
-		// For handling of https://go.dev/blog/loopvar-preview
-		ignoreCopied := ignore
-		ignores[ignore.URL] = &ignoreCopied
-	}
-
-	// Check lock file if it exists
-	lockFile, err := readLockFile(lockFilePath)
-	if err != nil {
-		// Lock file is optional, so just log a warning and continue
-		log.Printf("Warning: failed to read lock file: %v\n", err)
-	} else {
-		// Lock file was read successfully, verify entries if any exist
-		if len(lockFile.Locks) > 0 {
-			log.Printf("Verifying %d lock entries...\n", len(lockFile.Locks))
-			lockErrors := verifyLockFile(lockFile)
-			if len(lockErrors) > 0 {
-				log.Printf("Lock file verification failed with %d errors:\n", len(lockErrors))
-				for _, err := range lockErrors {
-					log.Printf("  %v\n", err)
-				}
-				os.Exit(1)
-			}
-			log.Printf("All lock entries verified successfully\n")
+	for _, s := range suppressions {
+		if !s.used {
+			log.Printf("Warning: %s:%d: unused suppression: %s, reason = %s\n", path, s.Line, s.Kind, s.Reason)
 		}
 	}
-
-	numErrors := 0
-	paths, err := listFiles()
-	if err != nil {
-		panic(err)
+	if len(livenessErrors) > 0 {
+		errs = append(errs, fmt.Errorf("liveness check failed: path = %s , %d links not alive: %w", path, len(livenessErrors), errors.Join(livenessErrors...)))
 	}
 
-	seen := make(map[string]struct{})
-	for _, path := range paths {
-		info, err := os.Stat(path)
-		if err != nil {
-			numErrors++
-			log.Printf("path = %s, %v\n", path, err)
-			continue
-		}
-		if info.IsDir() {
-			continue
-		}
-		ext := filepath.Ext(path)
-		ok := false
-		for _, e := range config.TextFileExtensions {
-			if ext == e {
-				ok = true
-				break
-			}
-		}
-		if ok {
-			if err := checkFile(path, config.RetryCount, ignores, config.PrefixIgnores, seen, readFile, httpHead); err != nil {
-				numErrors++
-				log.Printf("%v\n", err)
-			}
-		}
-		continue
-	}
-	if numErrors > 0 {
-		os.Exit(1)
-	}
+	return errors.Join(errs...)
+}
+
+func main() {
+	os.Exit(run(os.Args[1:]))
 }
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"net"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestStripTitleSuffix(t *testing.T) {
@@ -34,16 +39,16 @@ func TestStripTitleSuffix(t *testing.T) {
 }
 
 func TestCheckURLLiveness(t *testing.T) {
-	seen := map[string]struct{}{}
+	seen := newSeenURLs()
 	httpHead := getHttpHeadMock([]httpHeadEntry{
 		{"dummy-200", 200},
 		{"dummy-404", 404},
 	})
-	err := checkURLLiveness("dummy-200", 1, nil, seen, httpHead)
+	err := checkURLLiveness(context.Background(), "dummy-200", 1, nil, seen, httpHead)
 	if err != nil {
 		t.Errorf("err = %v, want nil", err)
 	}
-	err = checkURLLiveness("dummy-404", 1, nil, seen, httpHead)
+	err = checkURLLiveness(context.Background(), "dummy-404", 1, nil, seen, httpHead)
 	if err == nil {
 		t.Errorf("err = nil, want non-nil")
 	}
@@ -51,29 +56,28 @@ func TestCheckURLLiveness(t *testing.T) {
 		"dummy-200": {},
 		"dummy-404": {},
 	}
-	if !reflect.DeepEqual(seen, expectedSeen) {
-		t.Errorf("seen = %v, want %v", seen, expectedSeen)
+	if !reflect.DeepEqual(seen.keys, expectedSeen) {
+		t.Errorf("seen = %v, want %v", seen.keys, expectedSeen)
 	}
 }
 
 func TestCheckFile(t *testing.T) {
 	accessed := []string{}
-	var httpHead HttpAccessor = func(url string) (int, error) {
-		accessed = append(accessed, url)
+	var httpHead HttpAccessor = func(req HttpRequest) (int, error) {
+		accessed = append(accessed, req.URL)
 		return 200, nil
 	}
-	seen := map[string]struct{}{}
-	ignores := map[string]*Ignore{}
-	prefixIgnores := []PrefixIgnore{}
+	seen := newSeenURLs()
+	rules := []Rule{}
 	readFile := getReadFileMock([]readFileEntry{
 		{"dummy", "http://dummy-200\nhttps://dummy-404\n"},
 		{"dummy2", "http://dummy-200\nhttps://dummy-404\n"},
 	})
-	err := checkFile("dummy", 1, ignores, prefixIgnores, seen, readFile, httpHead)
+	err := checkFile(context.Background(), "dummy", 1, rules, seen, readFile, httpHead)
 	if err != nil {
 		t.Errorf("err = %v, want nil", err)
 	}
-	err = checkFile("dummy2", 1, ignores, prefixIgnores, seen, readFile, httpHead)
+	err = checkFile(context.Background(), "dummy2", 1, rules, seen, readFile, httpHead)
 	if err != nil {
 		t.Errorf("err = %v, want nil", err)
 	}
@@ -89,17 +93,16 @@ func TestCheckFile(t *testing.T) {
 
 func TestCheckFileWithTitleSuffix(t *testing.T) {
 	accessed := []string{}
-	var httpHead HttpAccessor = func(url string) (int, error) {
-		accessed = append(accessed, url)
+	var httpHead HttpAccessor = func(req HttpRequest) (int, error) {
+		accessed = append(accessed, req.URL)
 		return 200, nil
 	}
-	seen := map[string]struct{}{}
-	ignores := map[string]*Ignore{}
-	prefixIgnores := []PrefixIgnore{}
+	seen := newSeenURLs()
+	rules := []Rule{}
 	readFile := getReadFileMock([]readFileEntry{
 		{"dummy", "https://www.ibjapan.jp/information/2023/09/22.html:title\nhttp://example.com:title=Page Title\n"},
 	})
-	err := checkFile("dummy", 1, ignores, prefixIgnores, seen, readFile, httpHead)
+	err := checkFile(context.Background(), "dummy", 1, rules, seen, readFile, httpHead)
 	if err != nil {
 		t.Errorf("err = %v, want nil", err)
 	}
@@ -115,20 +118,19 @@ func TestCheckFileWithTitleSuffix(t *testing.T) {
 
 func TestCheckFileWithPrefixIgnore(t *testing.T) {
 	accessed := []string{}
-	var httpHead HttpAccessor = func(url string) (int, error) {
-		accessed = append(accessed, url)
+	var httpHead HttpAccessor = func(req HttpRequest) (int, error) {
+		accessed = append(accessed, req.URL)
 		return 200, nil
 	}
-	seen := map[string]struct{}{}
-	ignores := map[string]*Ignore{}
-	prefixIgnores := []PrefixIgnore{
+	seen := newSeenURLs()
+	rules := (&Config{PrefixIgnores: []PrefixIgnore{
 		{Prefix: "https://x.com/", Reason: "X.com links are ignored"},
 		{Prefix: "https://twitter.com/", Reason: "Twitter links are ignored"},
-	}
+	}}).buildRules()
 	readFile := getReadFileMock([]readFileEntry{
 		{"dummy", "https://x.com/user123\nhttp://example.com\nhttps://twitter.com/status/456\nhttps://github.com/koba-e964\n"},
 	})
-	err := checkFile("dummy", 1, ignores, prefixIgnores, seen, readFile, httpHead)
+	err := checkFile(context.Background(), "dummy", 1, rules, seen, readFile, httpHead)
 	if err != nil {
 		t.Errorf("err = %v, want nil", err)
 	}
@@ -142,29 +144,130 @@ func TestCheckFileWithPrefixIgnore(t *testing.T) {
 	}
 }
 
-func TestShouldIgnoreByPrefix(t *testing.T) {
-	prefixIgnores := []PrefixIgnore{
-		{Prefix: "https://x.com/", Reason: "X.com links are ignored"},
-		{Prefix: "https://twitter.com/", Reason: "Twitter links are ignored"},
+func TestCheckFileWithRules(t *testing.T) {
+	config := &Config{
+		TextFileExtensions: []string{".md"},
+		Rules: []Rule{
+			{Prefix: "https://csrc.nist.gov/", Codes: []int{200, 404}, Method: "GET", Timeout: "10s", Reason: "NIST returns 404 for HEAD"},
+			{Host: "flaky.example.com", Severity: severityWarning, Reason: "flaky"},
+			{URL: "https://tls.example.com/", AllowedErrors: []string{"dns"}, Headers: map[string]string{"Accept": "text/html"}, Reason: "broken DNS", ConsideredAlternatives: []string{"none"}},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	requests := map[string]HttpRequest{}
+	var httpAccess HttpAccessor = func(req HttpRequest) (int, error) {
+		requests[req.URL] = req
+		switch req.URL {
+		case "https://csrc.nist.gov/pubs":
+			return 404, nil
+		case "https://tls.example.com/":
+			return 0, &net.DNSError{Err: "no such host", Name: "tls.example.com"}
+		}
+		return 500, nil
+	}
+	readFile := getReadFileMock([]readFileEntry{
+		{"README.md", "https://csrc.nist.gov/pubs\nhttps://flaky.example.com/a\nhttps://tls.example.com/\n"},
+	})
+	if err := checkFile(context.Background(), "README.md", 1, config.rules, newSeenURLs(), readFile, httpAccess); err != nil {
+		t.Errorf("checkFile() error = %v, want nil", err)
+	}
+	nist := requests["https://csrc.nist.gov/pubs"]
+	if nist.Method != "GET" || nist.Timeout != 10*time.Second {
+		t.Errorf("request = %+v, want method GET and timeout 10s", nist)
+	}
+	if got := requests["https://tls.example.com/"].Headers["Accept"]; got != "text/html" {
+		t.Errorf("Accept header = %q, want text/html", got)
+	}
+	if got := requests["https://flaky.example.com/a"].Method; got != "HEAD" {
+		t.Errorf("method = %q, want HEAD", got)
 	}
 
-	tests := []struct {
-		url      string
-		expected bool
-	}{
-		{"https://x.com/user123", true},
-		{"https://x.com/", true},
-		{"https://twitter.com/status/456", true},
-		{"https://github.com/koba-e964", false},
-		{"http://example.com", false},
-		{"https://x.co/short", false}, // Should not match
+	// Errors that are not allowed still fail
+	config.Rules[2].AllowedErrors = []string{"tls"}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	err := checkFile(context.Background(), "README.md", 1, config.rules, newSeenURLs(), readFile, httpAccess)
+	var le *linkError
+	if !errors.As(err, &le) || le.URL != "https://tls.example.com/" {
+		t.Errorf("checkFile() error = %v, want a linkError for https://tls.example.com/", err)
 	}
+}
 
-	for _, test := range tests {
-		result := shouldIgnoreByPrefix(test.url, prefixIgnores)
-		matched := result != nil
-		if matched != test.expected {
-			t.Errorf("shouldIgnoreByPrefix(%q) matched=%v, want %v", test.url, matched, test.expected)
-		}
+func TestCheckFileWithScopedIgnore(t *testing.T) {
+	config := &Config{
+		TextFileExtensions: []string{".md"},
+		Ignores: []Ignore{
+			{URL: "https://paywalled.example.com/article", Codes: []int{403}, Reason: "paywalled", ConsideredAlternatives: []string{"none"}, Paths: []string{"docs/research/"}},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	accessed := 0
+	var httpHead HttpAccessor = func(req HttpRequest) (int, error) {
+		accessed++
+		return 403, nil
+	}
+	readFile := getReadFileMock([]readFileEntry{
+		{"docs/research/survey.md", "https://paywalled.example.com/article\n"},
+		{"README.md", "https://paywalled.example.com/article\n"},
+	})
+	seen := newSeenURLs()
+	if err := checkFile(context.Background(), "docs/research/survey.md", 1, config.rules, seen, readFile, httpHead); err != nil {
+		t.Errorf("checkFile(docs/research/survey.md) error = %v, want nil", err)
+	}
+	// Checked again, because the ignore does not apply to README.md
+	var le *linkError
+	if err := checkFile(context.Background(), "README.md", 1, config.rules, seen, readFile, httpHead); !errors.As(err, &le) {
+		t.Errorf("checkFile(README.md) error = %v, want a linkError", err)
+	}
+	if accessed != 2 {
+		t.Errorf("accessed = %d, want 2", accessed)
+	}
+
+	if rule := describeRule("https://paywalled.example.com/article", "docs/research/survey.md", config.rules); rule != "ignores[0] (codes [403], scope docs/research/)" {
+		t.Errorf("describeRule() = %q", rule)
+	}
+	var b strings.Builder
+	explainURL(&b, "https://paywalled.example.com/article", "README.md", config)
+	if want := `match, but README.md is out of scope (paths ["docs/research/"])`; !strings.Contains(b.String(), want) {
+		t.Errorf("explainURL() = %q, want to contain %q", b.String(), want)
+	}
+}
+
+func TestCheckFileWithSuppressions(t *testing.T) {
+	accessed := []string{}
+	var httpHead HttpAccessor = func(req HttpRequest) (int, error) {
+		accessed = append(accessed, req.URL)
+		return 200, nil
+	}
+	content := `<!-- link-checker: ignore-next-line "paywalled" -->
+https://a.example.com/
+https://b.example.com/ <!-- link-checker: ignore-line "login required" -->
+// link-checker: ignore-start "old mirrors"
+https://c.example.com/
+https://d.example.com/
+// link-checker: ignore-end
+# link-checker: ignore-next-line "nothing here"
+
+https://e.example.com/
+`
+	readFile := getReadFileMock([]readFileEntry{{"README.md", content}})
+	if err := checkFile(context.Background(), "README.md", 1, nil, newSeenURLs(), readFile, httpHead); err != nil {
+		t.Errorf("checkFile() error = %v, want nil", err)
+	}
+	if want := []string{"https://e.example.com/"}; !reflect.DeepEqual(accessed, want) {
+		t.Errorf("accessed = %v, want %v", accessed, want)
+	}
+
+	unused, err := findUnusedSuppressions([]string{"README.md"}, readFile)
+	if err != nil {
+		t.Fatalf("findUnusedSuppressions() error = %v, want nil", err)
+	}
+	if want := []string{`README.md:8: ignore-next-line "nothing here"`}; !reflect.DeepEqual(unused, want) {
+		t.Errorf("findUnusedSuppressions() = %v, want %v", unused, want)
 	}
 }
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"path"
+	"path/filepath"
+	"slices"
+)
+
+// sourceOf returns where setting came from, formatted as " (from path)", or "" if unknown.
+func (c *Config) sourceOf(setting string) string {
+	if source, ok := c.sources[setting]; ok && source != "" {
+		return fmt.Sprintf(" (from %s)", source)
+	}
+	return ""
+}
+
+// loadNestedConfigs reads the configuration files named check_links_config.toml in subdirectories among paths,
+// and merges each with the configuration of its parent directory. The root configuration is root.
+func loadNestedConfigs(root *Config, paths []string) error {
+	name := path.Base(defaultConfigFilePath)
+	dirs := []string{}
+	for _, p := range paths {
+		p = filepath.ToSlash(p)
+		if path.Base(p) == name && path.Dir(p) != "." {
+			dirs = append(dirs, path.Dir(p))
+		}
+	}
+	// A parent directory sorts before its subdirectories
+	slices.Sort(dirs)
+	root.nested = nil
+	root.effective = map[string]*Config{}
+	var errs []error
+	for _, dir := range dirs {
+		configPath := path.Join(dir, name)
+		child, err := readConfig(configPath)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read config %s: %w", configPath, err))
+			continue
+		}
+		child.dir = dir
+		child.rulePrefix = configPath + ":"
+		if err := child.Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("invalid config %s: %w", configPath, err))
+			continue
+		}
+		root.nested = append(root.nested, child)
+		root.effective[dir] = mergeConfigs(child, root.forFile(configPath))
+	}
+	return errors.Join(errs...)
+}
+
+// mergeConfigs returns the effective configuration in child's subtree, where parent is the effective configuration
+// of the parent directory: extensions are unioned, child's rules take precedence over parent's,
+// and child's retry_count overrides parent's if given.
+func mergeConfigs(child *Config, parent *Config) *Config {
+	merged := &Config{
+		RetryCount:         parent.RetryCount,
+		TextFileExtensions: slices.Clone(parent.TextFileExtensions),
+		rules:              append(slices.Clone(child.rules), parent.rules...),
+		path:               child.path,
+		dir:                child.dir,
+		files:              append(slices.Clone(child.files), parent.files...),
+		sources:            maps.Clone(parent.sources),
+	}
+	if merged.sources == nil {
+		merged.sources = map[string]string{}
+	}
+	if child.RetryCount != 0 {
+		merged.RetryCount = child.RetryCount
+		merged.sources["retry_count"] = child.sources["retry_count"]
+	}
+	for _, ext := range child.TextFileExtensions {
+		if !slices.Contains(merged.TextFileExtensions, ext) {
+			merged.TextFileExtensions = append(merged.TextFileExtensions, ext)
+			merged.sources[ext] = child.sources[ext]
+		}
+	}
+	return merged
+}
+
+// forFile returns the effective configuration for links in file: that of the nearest directory of file
+// with a nested configuration, or c itself.
+func (c *Config) forFile(file string) *Config {
+	if len(c.effective) == 0 || file == "" {
+		return c
+	}
+	for dir := path.Dir(filepath.ToSlash(file)); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if config, ok := c.effective[dir]; ok {
+			return config
+		}
+	}
+	return c
+}
+
+// allRules returns the rules of c and of its nested configurations, each once.
+func (c *Config) allRules() []*Rule {
+	rules := []*Rule{}
+	for _, config := range append([]*Config{c}, c.nested...) {
+		for i := range config.rules {
+			rules = append(rules, &config.rules[i])
+		}
+	}
+	return rules
+}
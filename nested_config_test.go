@@ -0,0 +1,98 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestNestedConfigs(t *testing.T) {
+	tmpDir := t.TempDir()
+	rootPath := filepath.Join(tmpDir, "check_links_config.toml")
+	docsPath := filepath.Join(tmpDir, "docs", "check_links_config.toml")
+	researchPath := filepath.Join(tmpDir, "docs", "research", "check_links_config.toml")
+	files := map[string]string{
+		rootPath: `retry_count = 3
+text_file_extensions = [".md"]
+
+[[prefix_ignores]]
+prefix = "https://x.com/"
+reason = "x.com doesn't seem to allow scraping"
+`,
+		docsPath: `text_file_extensions = [".rst"]
+
+[[prefix_ignores]]
+prefix = "https://x.com/docs-team"
+reason = "docs team account"
+`,
+		researchPath: `retry_count = 1
+
+[[ignores]]
+url = "https://paywalled.example.com/article"
+codes = [403]
+reason = "paywalled"
+considered_alternatives = ["none"]
+`,
+	}
+	for path, content := range files {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+	}
+	root, err := readConfig(rootPath)
+	if err != nil {
+		t.Fatalf("readConfig() error = %v, want nil", err)
+	}
+	if err := root.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	// The root configuration is not among the nested ones
+	if err := loadNestedConfigs(root, []string{filepath.Join(tmpDir, "README.md"), researchPath, docsPath}); err != nil {
+		t.Fatalf("loadNestedConfigs() error = %v, want nil", err)
+	}
+
+	readme := filepath.Join(tmpDir, "README.md")
+	docsFile := filepath.Join(tmpDir, "docs", "index.rst")
+	researchFile := filepath.Join(tmpDir, "docs", "research", "survey.md")
+	if config := root.forFile(readme); config != root {
+		t.Errorf("forFile(README.md) = %s, want the root configuration", config.path)
+	}
+	docs := root.forFile(docsFile)
+	research := root.forFile(researchFile)
+	if !slices.Equal(docs.TextFileExtensions, []string{".md", ".rst"}) || !slices.Equal(research.TextFileExtensions, []string{".md", ".rst"}) {
+		t.Errorf("TextFileExtensions = %v, %v, want extensions to be unioned", docs.TextFileExtensions, research.TextFileExtensions)
+	}
+	if docs.RetryCount != 3 || research.RetryCount != 1 {
+		t.Errorf("RetryCount = %d, %d, want 3 (inherited) and 1 (overridden)", docs.RetryCount, research.RetryCount)
+	}
+	if got := research.sourceOf("retry_count"); got != " (from "+researchPath+")" {
+		t.Errorf("sourceOf(retry_count) = %q", got)
+	}
+	if got := research.sourceOf(".md"); got != " (from "+rootPath+")" {
+		t.Errorf("sourceOf(.md) = %q", got)
+	}
+
+	// Rules of nested configurations take precedence over their parents' and apply only to their subtrees
+	for _, test := range []struct {
+		url      string
+		file     string
+		expected string
+	}{
+		{"https://x.com/docs-team", readme, "prefix_ignores[0]"},
+		{"https://x.com/docs-team", researchFile, docsPath + ":prefix_ignores[0]"},
+		{"https://x.com/someone", researchFile, "prefix_ignores[0]"},
+		{"https://paywalled.example.com/article", researchFile, researchPath + ":ignores[0]"},
+		{"https://paywalled.example.com/article", docsFile, "default"},
+	} {
+		if name := matchRule(test.url, test.file, root.forFile(test.file).rules).name(); name != test.expected {
+			t.Errorf("matchRule(%q, %q) = %s, want %s", test.url, test.file, name, test.expected)
+		}
+	}
+	if n := len(root.allRules()); n != 3 {
+		t.Errorf("len(allRules()) = %d, want 3", n)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Default number of requests made at the same time
+const defaultJobs = 8
+
+// workerPool runs jobs on a fixed number of goroutines.
+type workerPool struct {
+	jobs    chan func()
+	workers sync.WaitGroup
+	pending sync.WaitGroup
+}
+
+func newWorkerPool(workers int) *workerPool {
+	p := &workerPool{jobs: make(chan func())}
+	for range max(workers, 1) {
+		p.workers.Add(1)
+		go func() {
+			defer p.workers.Done()
+			for job := range p.jobs {
+				job()
+			}
+		}()
+	}
+	return p
+}
+
+// submit runs job on a worker, waiting for one to be free. Jobs must not submit other jobs.
+func (p *workerPool) submit(job func()) {
+	p.pending.Add(1)
+	p.jobs <- func() {
+		defer p.pending.Done()
+		job()
+	}
+}
+
+// wait waits for all submitted jobs to finish.
+func (p *workerPool) wait() {
+	p.pending.Wait()
+}
+
+// close stops the workers after the submitted jobs.
+func (p *workerPool) close() {
+	close(p.jobs)
+	p.workers.Wait()
+}
+
+// retry calls attempt up to retryCount times with exponential backoff, as long as it fails with retryable = true,
+// and returns the last error, or ctx's error if ctx ends first. Link checks and lock verifications share this policy.
+func retry(ctx context.Context, retryCount int, attempt func() (retryable bool, err error)) error {
+	for i := 0; i < retryCount; i++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		retryable, err := attempt()
+		if err == nil || !retryable || i == retryCount-1 {
+			return err
+		}
+		// exponential backoff
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After((1 << i) * time.Second):
+		}
+	}
+	return nil
+}
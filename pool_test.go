@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCheckFilesOnWorkerPool(t *testing.T) {
+	var mu sync.Mutex
+	accessed := map[string]int{}
+	var httpHead HttpAccessor = func(req HttpRequest) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		accessed[req.URL]++
+		return 200, nil
+	}
+	entries := []readFileEntry{}
+	paths := []string{}
+	for i := range 20 {
+		path := fmt.Sprintf("file%d.md", i)
+		entries = append(entries, readFileEntry{path, fmt.Sprintf("https://example.com/shared\nhttps://example.com/%d\n", i)})
+		paths = append(paths, path)
+	}
+	readFile := getReadFileMock(entries)
+
+	pool := newWorkerPool(4)
+	defer pool.close()
+	seen := newSeenURLs()
+	results := make([]error, len(paths))
+	for i, path := range paths {
+		pool.submit(func() {
+			results[i] = checkFile(context.Background(), path, 1, nil, seen, readFile, httpHead)
+		})
+	}
+	pool.wait()
+	for i, err := range results {
+		if err != nil {
+			t.Errorf("checkFile(%s) error = %v, want nil", paths[i], err)
+		}
+	}
+	// Each URL is checked once, even by concurrent checks
+	if len(accessed) != 21 {
+		t.Errorf("len(accessed) = %d, want 21", len(accessed))
+	}
+	for url, count := range accessed {
+		if count != 1 {
+			t.Errorf("accessed[%s] = %d, want 1", url, count)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	err := retry(context.Background(), 3, func() (bool, error) {
+		attempts++
+		return false, errors.New("not retryable")
+	})
+	if err == nil || attempts != 1 {
+		t.Errorf("retry() = %v after %d attempts, want an error after 1", err, attempts)
+	}
+	attempts = 0
+	err = retry(context.Background(), 3, func() (bool, error) {
+		attempts++
+		return true, nil
+	})
+	if err != nil || attempts != 1 {
+		t.Errorf("retry() = %v after %d attempts, want nil after 1", err, attempts)
+	}
+	// Cancellation stops the backoff
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts = 0
+	start := time.Now()
+	err = retry(ctx, 3, func() (bool, error) {
+		attempts++
+		cancel()
+		return true, errors.New("retryable")
+	})
+	if !errors.Is(err, context.Canceled) || attempts != 1 || time.Since(start) > 500*time.Millisecond {
+		t.Errorf("retry() = %v after %d attempts in %v, want context.Canceled after 1 without waiting", err, attempts, time.Since(start))
+	}
+}
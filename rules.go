@@ -0,0 +1,472 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Rule decides how URLs are checked: a matcher selects URLs, and actions say how to check them.
+//
+// [[ignores]], [[prefix_ignores]] and [[pattern_ignores]] are sugar for rules (see Config.buildRules).
+type Rule struct {
+	// Matcher: exactly one of URL (exact match), Prefix, or Host and/or Regex (pattern) must be given.
+	URL    string `toml:"url,omitempty"`
+	Prefix string `toml:"prefix,omitempty"`
+	// Glob (as in path.Match) matched against the URL's host, e.g. "*.slack.com"
+	Host string `toml:"host,omitempty"`
+	// Regular expression matched against the whole URL; it is anchored at both ends
+	Regex string `toml:"regex,omitempty"`
+	// If given, the rule only applies to links in files matching one of these globs (see matchPath)
+	Paths []string `toml:"paths,omitempty"`
+
+	// Actions
+	// Do not check matching URLs at all
+	Skip bool `toml:"skip,omitempty"`
+	// Accepted status codes instead of the 2xx criterion
+	Codes []int `toml:"codes,omitempty"`
+	// Accepted classes of request errors: tls, timeout, dns, connection or any
+	AllowedErrors []string `toml:"allowed_errors,omitempty"`
+	// HEAD (default) or GET
+	Method string `toml:"method,omitempty"`
+	// Timeout of each request, e.g. "10s"; no timeout by default
+	Timeout string            `toml:"timeout,omitempty"`
+	Headers map[string]string `toml:"headers,omitempty"`
+	// error (default) fails the run; warning only logs
+	Severity string `toml:"severity,omitempty"`
+
+	Reason                 string   `toml:"reason"`
+	ConsideredAlternatives []string `toml:"considered_alternatives,omitempty"`
+	// The last day the rule applies, e.g. expires = 2026-12-31 (a TOML date, not a string)
+	Expires time.Time `toml:"expires,omitempty"`
+	// The day by which the rule should be reviewed; it only causes warnings
+	ReviewBy time.Time `toml:"review_by,omitempty"`
+
+	// set by Config.Validate
+	origin  string
+	regex   *regexp.Regexp
+	timeout time.Duration
+	// expired, and expired_rules = "disable"
+	disabled bool
+	// from a file read through include
+	included bool
+}
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+)
+
+var errorClasses = []string{"tls", "timeout", "dns", "connection", "any"}
+
+// Matches reports whether url matches r. r must have been compiled by Config.Validate.
+func (r *Rule) Matches(rawURL string) bool {
+	switch {
+	case r.URL != "":
+		return rawURL == r.URL
+	case r.Prefix != "":
+		return strings.HasPrefix(rawURL, r.Prefix)
+	}
+	if r.Host != "" {
+		parsed, err := url.Parse(rawURL)
+		if err != nil {
+			return false
+		}
+		if ok, _ := path.Match(strings.ToLower(r.Host), strings.ToLower(parsed.Hostname())); !ok {
+			return false
+		}
+	}
+	if r.regex != nil && !r.regex.MatchString(rawURL) {
+		return false
+	}
+	return true
+}
+
+// scope returns the first glob in r.Paths that file matches, or "" if r.Paths is empty.
+// ok is false if r does not apply to links in file.
+func (r *Rule) scope(file string) (pattern string, ok bool) {
+	if len(r.Paths) == 0 {
+		return "", true
+	}
+	if file == "" {
+		return "", false
+	}
+	file = filepath.ToSlash(filepath.Clean(file))
+	for _, pattern := range r.Paths {
+		if matchPath(pattern, file) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// matchPath reports whether the slash-separated file name matches pattern, a glob as in path.Match
+// except that a "**" element matches any number of directories, and a trailing "/" matches everything
+// under the directory, e.g. "docs/research/" is the same as "docs/research/**".
+func matchPath(pattern string, name string) bool {
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	return matchPathElements(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchPathElements(patterns []string, names []string) bool {
+	if len(patterns) == 0 {
+		return len(names) == 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if matchPathElements(patterns[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(patterns[0], names[0]); !ok {
+		return false
+	}
+	return matchPathElements(patterns[1:], names[1:])
+}
+
+// matchString describes how r matches a link found in file, e.g.
+// `ignores[0] (url = "https://example.com/", scope docs/research/)`.
+func (r *Rule) matchString(file string) string {
+	if pattern, _ := r.scope(file); pattern != "" {
+		return fmt.Sprintf("%s (%s, scope %s)", r.origin, r.matcherString(), pattern)
+	}
+	return fmt.Sprintf("%s (%s)", r.origin, r.matcherString())
+}
+
+// matcherString describes r's matcher, e.g. `prefix = "https://x.com/"`.
+func (r *Rule) matcherString() string {
+	switch {
+	case r.URL != "":
+		return fmt.Sprintf("url = %q", r.URL)
+	case r.Prefix != "":
+		return fmt.Sprintf("prefix = %q", r.Prefix)
+	case r.Host != "" && r.Regex != "":
+		return fmt.Sprintf("host = %q, regex = %q", r.Host, r.Regex)
+	case r.Host != "":
+		return fmt.Sprintf("host = %q", r.Host)
+	case r.Regex != "":
+		return fmt.Sprintf("regex = %q", r.Regex)
+	default:
+		return "no matcher"
+	}
+}
+
+// actionString describes what r does, e.g. "codes [200 404], method GET".
+func (r *Rule) actionString() string {
+	if r.Skip {
+		return "skip"
+	}
+	parts := []string{}
+	if len(r.Codes) > 0 {
+		parts = append(parts, fmt.Sprintf("codes %v", r.Codes))
+	} else {
+		parts = append(parts, "2xx")
+	}
+	if len(r.AllowedErrors) > 0 {
+		parts = append(parts, fmt.Sprintf("allowed_errors %v", r.AllowedErrors))
+	}
+	if r.Method != "" {
+		parts = append(parts, "method "+r.Method)
+	}
+	if r.timeout != 0 {
+		parts = append(parts, "timeout "+r.timeout.String())
+	}
+	if len(r.Headers) > 0 {
+		keys := []string{}
+		for key := range r.Headers {
+			keys = append(keys, key)
+		}
+		slices.Sort(keys)
+		parts = append(parts, fmt.Sprintf("headers %v", keys))
+	}
+	if r.severity() != severityError {
+		parts = append(parts, "severity "+r.severity())
+	}
+	return strings.Join(parts, ", ")
+}
+
+// name returns where r came from, e.g. "ignores[0]". r may be nil.
+func (r *Rule) name() string {
+	if r == nil {
+		return "default"
+	}
+	return r.origin
+}
+
+// severity returns r's severity. r may be nil.
+func (r *Rule) severity() string {
+	if r == nil || r.Severity == "" {
+		return severityError
+	}
+	return r.Severity
+}
+
+// request returns the request to check url under r, which may be nil.
+func (r *Rule) request(url string) HttpRequest {
+	req := HttpRequest{Method: "HEAD", URL: url}
+	if r != nil {
+		if r.Method != "" {
+			req.Method = r.Method
+		}
+		req.Timeout = r.timeout
+		req.Headers = r.Headers
+	}
+	return req
+}
+
+// acceptsStatus reports whether statusCode is a success under r, which may be nil.
+func (r *Rule) acceptsStatus(statusCode int) bool {
+	if r == nil || len(r.Codes) == 0 {
+		return statusCode/100 == 2
+	}
+	return slices.Contains(r.Codes, statusCode)
+}
+
+// acceptsError reports whether the request error err is a success under r, which may be nil.
+func (r *Rule) acceptsError(err error) bool {
+	if r == nil {
+		return false
+	}
+	class := classifyError(err)
+	for _, allowed := range r.AllowedErrors {
+		if allowed == "any" || allowed == class {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyError returns the class of a request error, as used in allowed_errors.
+func classifyError(err error) string {
+	if isTimeout(err) {
+		return "timeout"
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return "dns"
+	}
+	var unknownAuthorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var certificateInvalidErr x509.CertificateInvalidError
+	var verificationErr *tls.CertificateVerificationError
+	var recordHeaderErr tls.RecordHeaderError
+	var alertErr tls.AlertError
+	if errors.As(err, &unknownAuthorityErr) || errors.As(err, &hostnameErr) || errors.As(err, &certificateInvalidErr) ||
+		errors.As(err, &verificationErr) || errors.As(err, &recordHeaderErr) || errors.As(err, &alertErr) {
+		return "tls"
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) {
+		return "connection"
+	}
+	return "other"
+}
+
+// validate returns the problems of a rule written in [[rules]].
+func (r *Rule) validate() []error {
+	var errs []error
+	matchers := 0
+	for _, given := range []bool{r.URL != "", r.Prefix != "", r.Host != "" || r.Regex != ""} {
+		if given {
+			matchers++
+		}
+	}
+	if matchers != 1 {
+		errs = append(errs, errors.New("exactly one of url, prefix, or host/regex must be given"))
+	}
+	if r.Skip && (len(r.Codes) > 0 || len(r.AllowedErrors) > 0 || r.Method != "" || r.Timeout != "" || len(r.Headers) > 0) {
+		errs = append(errs, errors.New("skip cannot be combined with codes, allowed_errors, method, timeout or headers"))
+	}
+	for _, class := range r.AllowedErrors {
+		if !slices.Contains(errorClasses, class) {
+			errs = append(errs, fmt.Errorf("unknown class in allowed_errors: %q (expected one of %v)", class, errorClasses))
+		}
+	}
+	if r.Method != "" && r.Method != "HEAD" && r.Method != "GET" {
+		errs = append(errs, fmt.Errorf("unsupported method: %q (expected HEAD or GET)", r.Method))
+	}
+	if r.Severity != "" && r.Severity != severityError && r.Severity != severityWarning {
+		errs = append(errs, fmt.Errorf("unknown severity: %q (expected error or warning)", r.Severity))
+	}
+	if r.Reason == "" {
+		errs = append(errs, errors.New("reason cannot be empty"))
+	}
+	if r.URL != "" && !r.Skip && len(r.ConsideredAlternatives) == 0 {
+		errs = append(errs, errors.New("considered_alternatives cannot be empty for url rules"))
+	}
+	return errs
+}
+
+// compile compiles r's regex and timeout.
+func (r *Rule) compile() error {
+	if r.Host != "" {
+		if _, err := path.Match(r.Host, ""); err != nil {
+			return fmt.Errorf("invalid host glob: %w", err)
+		}
+	}
+	for _, pattern := range r.Paths {
+		for _, element := range strings.Split(pattern, "/") {
+			if _, err := path.Match(element, ""); err != nil {
+				return fmt.Errorf("invalid glob in paths: %q: %w", pattern, err)
+			}
+		}
+	}
+	if r.Regex != "" {
+		regex, err := regexp.Compile("^(?:" + r.Regex + ")$")
+		if err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+		r.regex = regex
+	}
+	if r.Timeout != "" {
+		timeout, err := time.ParseDuration(r.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("invalid timeout: %q", r.Timeout)
+		}
+		r.timeout = timeout
+	}
+	return nil
+}
+
+// buildRules returns c's own rules in order of precedence: [[rules]] in order, then [[prefix_ignores]],
+// [[pattern_ignores]] and [[ignores]]. Ignores are added in reverse order so that, as before,
+// the last entry for a URL wins.
+func (c *Config) buildRules() []Rule {
+	rules := []Rule{}
+	for i, rule := range c.Rules {
+		rule.origin = fmt.Sprintf("%srules[%d]", c.rulePrefix, i)
+		rules = append(rules, rule)
+	}
+	for i, prefixIgnore := range c.PrefixIgnores {
+		rules = append(rules, Rule{
+			Prefix:   prefixIgnore.Prefix,
+			Skip:     true,
+			Reason:   prefixIgnore.Reason,
+			Paths:    prefixIgnore.Paths,
+			Expires:  prefixIgnore.Expires,
+			ReviewBy: prefixIgnore.ReviewBy,
+			origin:   fmt.Sprintf("%sprefix_ignores[%d]", c.rulePrefix, i),
+		})
+	}
+	for i, patternIgnore := range c.PatternIgnores {
+		rules = append(rules, Rule{
+			Host:     patternIgnore.Host,
+			Regex:    patternIgnore.Regex,
+			Skip:     true,
+			Reason:   patternIgnore.Reason,
+			Paths:    patternIgnore.Paths,
+			Expires:  patternIgnore.Expires,
+			ReviewBy: patternIgnore.ReviewBy,
+			origin:   fmt.Sprintf("%spattern_ignores[%d]", c.rulePrefix, i),
+		})
+	}
+	for i := len(c.Ignores) - 1; i >= 0; i-- {
+		ignore := c.Ignores[i]
+		rule := Rule{
+			URL:                    ignore.URL,
+			Codes:                  ignore.Codes,
+			Reason:                 ignore.Reason,
+			ConsideredAlternatives: ignore.ConsideredAlternatives,
+			Paths:                  ignore.Paths,
+			Expires:                ignore.Expires,
+			ReviewBy:               ignore.ReviewBy,
+			origin:                 fmt.Sprintf("%signores[%d]", c.rulePrefix, i),
+		}
+		if ignore.HasTLSError {
+			// has_tls_error has always accepted any request error
+			rule.AllowedErrors = []string{"any"}
+		}
+		rules = append(rules, rule)
+	}
+	for i := range rules {
+		rules[i].included = c.fromInclude
+	}
+	return rules
+}
+
+// matchRule returns the first rule in rules that matches url found in file, or nil.
+// Rules scoped by paths do not apply if file is empty. Disabled rules are not considered.
+func matchRule(url string, file string, rules []Rule) *Rule {
+	for i := range rules {
+		if rules[i].disabled || !rules[i].Matches(url) {
+			continue
+		}
+		if _, ok := rules[i].scope(file); ok {
+			return &rules[i]
+		}
+	}
+	return nil
+}
+
+// describeRule describes the rule that applies to url found in file, e.g. "prefix_ignores[0] (skip)"
+// or "ignores[0] (codes [403], scope docs/research/)".
+func describeRule(url string, file string, rules []Rule) string {
+	rule := matchRule(url, file, rules)
+	if rule == nil {
+		return "default (2xx)"
+	}
+	if pattern, _ := rule.scope(file); pattern != "" {
+		return fmt.Sprintf("%s (%s, scope %s)", rule.origin, rule.actionString(), pattern)
+	}
+	return fmt.Sprintf("%s (%s)", rule.origin, rule.actionString())
+}
+
+const (
+	expiredRulesDisable = "disable"
+	expiredRulesWarn    = "warn"
+)
+
+// Rules expiring or due for review within this period cause warnings
+const expiryWarningPeriod = 30 * 24 * time.Hour
+
+// timeNow is replaced in tests.
+var timeNow = time.Now
+
+// toDate returns t's calendar date as midnight UTC, so that dates can be compared and subtracted.
+func toDate(t time.Time) time.Time {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+}
+
+// checkExpiry returns warnings about r's expires and review_by dates as of today.
+// A rule expires at the end of its expires date.
+func (r *Rule) checkExpiry(today time.Time) (expired bool, warnings []string) {
+	where := fmt.Sprintf("%s (%s)", r.origin, r.matcherString())
+	if !r.Expires.IsZero() {
+		expires := toDate(r.Expires)
+		switch {
+		case today.After(expires):
+			expired = true
+		case expires.Sub(today) < expiryWarningPeriod:
+			warnings = append(warnings, fmt.Sprintf("%s: expires on %s (in %d days)",
+				where, expires.Format(time.DateOnly), int(expires.Sub(today).Hours()/24)))
+		}
+	}
+	if !r.ReviewBy.IsZero() && !expired {
+		reviewBy := toDate(r.ReviewBy)
+		switch {
+		case today.After(reviewBy):
+			warnings = append(warnings, fmt.Sprintf("%s: review was due on %s", where, reviewBy.Format(time.DateOnly)))
+		case reviewBy.Sub(today) < expiryWarningPeriod:
+			warnings = append(warnings, fmt.Sprintf("%s: review is due on %s (in %d days)",
+				where, reviewBy.Format(time.DateOnly), int(reviewBy.Sub(today).Hours()/24)))
+		}
+	}
+	return expired, warnings
+}
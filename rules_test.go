@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchRuleByPrefix(t *testing.T) {
+	rules := (&Config{PrefixIgnores: []PrefixIgnore{
+		{Prefix: "https://x.com/", Reason: "X.com links are ignored"},
+		{Prefix: "https://twitter.com/", Reason: "Twitter links are ignored"},
+	}}).buildRules()
+
+	tests := []struct {
+		url      string
+		expected bool
+	}{
+		{"https://x.com/user123", true},
+		{"https://x.com/", true},
+		{"https://twitter.com/status/456", true},
+		{"https://github.com/koba-e964", false},
+		{"http://example.com", false},
+		{"https://x.co/short", false}, // Should not match
+	}
+
+	for _, test := range tests {
+		result := matchRule(test.url, "", rules)
+		matched := result != nil
+		if matched != test.expected {
+			t.Errorf("matchRule(%q) matched=%v, want %v", test.url, matched, test.expected)
+		}
+	}
+}
+
+func TestMatchRuleByPattern(t *testing.T) {
+	config := &Config{
+		TextFileExtensions: []string{".md"},
+		PatternIgnores: []PatternIgnore{
+			{Host: "*.slack.com", Reason: "Slack invite links require login"},
+			{Regex: `https://github\.com/koba-e964/link-checker/issues/\d+`, Reason: "issues are checked elsewhere"},
+			{Host: "example.com", Regex: `https?://example\.com/private/.*`, Reason: "both must match"},
+		},
+	}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+
+	tests := []struct {
+		url      string
+		expected string
+	}{
+		{"https://myteam.slack.com/join/abc", "pattern_ignores[0]"},
+		{"https://MyTeam.Slack.com/join/abc", "pattern_ignores[0]"},
+		{"https://slack.com/", "default"},
+		{"https://github.com/koba-e964/link-checker/issues/12", "pattern_ignores[1]"},
+		// The regex is anchored at both ends
+		{"https://github.com/koba-e964/link-checker/issues/12#comment", "default"},
+		{"https://example.org/?https://github.com/koba-e964/link-checker/issues/12", "default"},
+		{"https://example.com/private/a", "pattern_ignores[2]"},
+		{"https://example.com/public/a", "default"},
+	}
+	for _, test := range tests {
+		if name := matchRule(test.url, "", config.rules).name(); name != test.expected {
+			t.Errorf("matchRule(%q) = %s, want %s", test.url, name, test.expected)
+		}
+	}
+
+	// Prefix ignores take precedence over pattern ignores, which take precedence over exact ignores
+	config.PrefixIgnores = []PrefixIgnore{{Prefix: "https://myteam.slack.com/", Reason: "prefix"}}
+	config.Ignores = []Ignore{{URL: "https://example.com/private/a", Codes: []int{404}, Reason: "exact", ConsideredAlternatives: []string{"none"}}}
+	if err := config.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v, want nil", err)
+	}
+	for url, expected := range map[string]string{
+		"https://myteam.slack.com/join/abc": "prefix_ignores[0] (skip)",
+		"https://other.slack.com/join/abc":  "pattern_ignores[0] (skip)",
+		"https://example.com/private/a":     "pattern_ignores[2] (skip)",
+	} {
+		if rule := describeRule(url, "", config.rules); rule != expected {
+			t.Errorf("describeRule(%q) = %q, want %q", url, rule, expected)
+		}
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	config := &Config{
+		TextFileExtensions: []string{".md"},
+		Rules: []Rule{
+			{Reason: "no matcher"},
+			{URL: "https://a.example.com/", Prefix: "https://a.example.com/", Skip: true, Reason: "two matchers"},
+			{Prefix: "https://b.example.com/", Skip: true, Codes: []int{404}, Reason: "skip with codes"},
+			{Prefix: "https://c.example.com/", AllowedErrors: []string{"ssl"}, Method: "POST", Severity: "info", Timeout: "soon", Reason: "bad values"},
+			{URL: "https://d.example.com/", Codes: []int{404}},
+		},
+	}
+	err := config.Validate()
+	if err == nil {
+		t.Fatal("Validate() error = nil, want non-nil")
+	}
+	for _, want := range []string{
+		"rules[0] (no matcher): exactly one of url, prefix, or host/regex must be given",
+		"rules[1] (url = \"https://a.example.com/\"): exactly one of url, prefix, or host/regex must be given",
+		"rules[2] (prefix = \"https://b.example.com/\"): skip cannot be combined",
+		`unknown class in allowed_errors: "ssl"`,
+		`unsupported method: "POST"`,
+		`unknown severity: "info"`,
+		`rules[3] (prefix = "https://c.example.com/"): invalid timeout: "soon"`,
+		`rules[4] (url = "https://d.example.com/"): reason cannot be empty`,
+		`rules[4] (url = "https://d.example.com/"): considered_alternatives cannot be empty`,
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error = %v, want to contain %q", err, want)
+		}
+	}
+}
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		name     string
+		expected bool
+	}{
+		{"README.md", "README.md", true},
+		{"*.md", "README.md", true},
+		{"*.md", "docs/README.md", false},
+		{"**/*.md", "docs/README.md", true},
+		{"**/*.md", "README.md", true},
+		{"docs/research/", "docs/research/a.md", true},
+		{"docs/research/", "docs/research/2024/a.md", true},
+		{"docs/research/", "docs/researchers.md", false},
+		{"docs/**/a.md", "docs/x/y/a.md", true},
+		{"docs/*/a.md", "docs/x/y/a.md", false},
+	}
+	for _, test := range tests {
+		if result := matchPath(test.pattern, test.name); result != test.expected {
+			t.Errorf("matchPath(%q, %q) = %v, want %v", test.pattern, test.name, result, test.expected)
+		}
+	}
+}
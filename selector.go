@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+)
+
+// cssSelector is a selector list, matching an element if any of its selectors does.
+type cssSelector struct {
+	group cascadia.SelectorGroup
+}
+
+// parseSelector parses s as a CSS selector list, as cascadia supports it.
+func parseSelector(s string) (cssSelector, error) {
+	group, err := cascadia.ParseGroup(s)
+	if err != nil {
+		return cssSelector{}, fmt.Errorf("invalid selector %q: %w", s, err)
+	}
+	return cssSelector{group}, nil
+}
+
+func (s cssSelector) matches(n *html.Node) bool {
+	return n.Type == html.ElementNode && s.group.Match(n)
+}
+
+// union returns the selector list matching the elements either s or t matches.
+func (s cssSelector) union(t cssSelector) cssSelector {
+	return cssSelector{append(s.group[:len(s.group):len(s.group)], t.group...)}
+}
+
+// selectNodes returns the elements matching s in root, in document order, leaving out those inside another match.
+func (s cssSelector) selectNodes(root *html.Node) []*html.Node {
+	nodes := []*html.Node{}
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if s.matches(n) {
+			nodes = append(nodes, n)
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(root)
+	return nodes
+}
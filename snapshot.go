@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Snapshots are the text of locked content, stored under Config.SnapshotDir so that a change can be shown as a diff.
+// They are content-addressed: the file name is the hash of the content (an accepted hash of the lock entry).
+
+// snapshotPath returns the path of the snapshot of content hashed as hash with hashVersion.
+func snapshotPath(dir string, hashVersion string, hash string) string {
+	return filepath.Join(dir, hashVersion+"-"+hash+".txt")
+}
+
+// writeSnapshot stores text as the snapshot of the content of lock, unless it is already stored.
+// lock must have been hashed from text, so that all its accepted hashes are of text.
+func writeSnapshot(dir string, lock Lock, text string) error {
+	for _, h := range lock.acceptedHashes() {
+		path := snapshotPath(dir, lock.HashVersion, h.Hash)
+		if _, err := os.Stat(path); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, []byte(text), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSnapshot returns the snapshot of the content of lock, that of its first accepted hash that has one,
+// or ok = false if none is stored.
+func readSnapshot(dir string, lock Lock) (text string, ok bool, err error) {
+	for _, h := range lock.acceptedHashes() {
+		content, err := os.ReadFile(snapshotPath(dir, lock.HashVersion, h.Hash))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return string(content), true, nil
+	}
+	return "", false, nil
+}
+
+// snapshotDiff returns a unified diff from the snapshot of lock to current, the text of the current content,
+// or a note on why there is none.
+func snapshotDiff(dir string, lock Lock, current string) string {
+	snapshot, ok, err := readSnapshot(dir, lock)
+	if err != nil {
+		return fmt.Sprintf("(failed to read the snapshot: %v)", err)
+	}
+	if !ok {
+		return fmt.Sprintf("(no snapshot of the locked content in %s)", dir)
+	}
+	diff := unifiedDiff("locked", "current", splitLines(snapshot), splitLines(current))
+	if diff == "" {
+		return "(the text is unchanged; the difference is in markup or bytes not in the text)"
+	}
+	return strings.TrimSuffix(diff, "\n")
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+)
+
+// Inline markers, written in a comment of any syntax, e.g. <!-- link-checker: ignore-next-line "paywalled" -->
+var suppressionRegex = regexp.MustCompile(`link-checker:\s*(ignore-next-line|ignore-line|ignore-start|ignore-end)\b(?:\s*"([^"]*)")?`)
+
+// suppression is an inline marker that suppresses the checks of links on some lines.
+type suppression struct {
+	// line of the marker
+	Line   int
+	Kind   string
+	Reason string
+	// suppressed lines, inclusive
+	From int
+	To   int
+	// whether any link is suppressed
+	used bool
+}
+
+// parseSuppressions returns the suppressions in content, the file at path.
+// Markers without a reason and unbalanced ignore-start/ignore-end are errors.
+func parseSuppressions(path string, content []byte) ([]suppression, []error) {
+	suppressions := []suppression{}
+	var errs []error
+	// index of the block being read, or -1
+	open := -1
+	lines := bytes.Split(content, []byte("\n"))
+	for i, text := range lines {
+		line := i + 1
+		for _, match := range suppressionRegex.FindAllSubmatch(text, -1) {
+			kind, reason := string(match[1]), string(match[2])
+			if kind == "ignore-end" {
+				if open < 0 {
+					errs = append(errs, fmt.Errorf("%s:%d: ignore-end without ignore-start", path, line))
+					continue
+				}
+				suppressions[open].To = line
+				open = -1
+				continue
+			}
+			if reason == "" {
+				errs = append(errs, fmt.Errorf("%s:%d: %s requires a reason, e.g. link-checker: %s \"paywalled\"", path, line, kind, kind))
+				continue
+			}
+			s := suppression{Line: line, Kind: kind, Reason: reason, From: line, To: line}
+			switch kind {
+			case "ignore-next-line":
+				s.From, s.To = line+1, line+1
+			case "ignore-start":
+				if open >= 0 {
+					errs = append(errs, fmt.Errorf("%s:%d: ignore-start inside the block started at line %d", path, line, suppressions[open].Line))
+					continue
+				}
+				open = len(suppressions)
+			}
+			suppressions = append(suppressions, s)
+		}
+	}
+	if open >= 0 {
+		errs = append(errs, fmt.Errorf("%s:%d: ignore-start without ignore-end", path, suppressions[open].Line))
+		suppressions[open].To = len(lines)
+	}
+	return suppressions, errs
+}
+
+// suppressionAt returns the suppression of line and marks it used, or returns nil.
+func suppressionAt(line int, suppressions []suppression) *suppression {
+	for i := range suppressions {
+		if suppressions[i].From <= line && line <= suppressions[i].To {
+			suppressions[i].used = true
+			return &suppressions[i]
+		}
+	}
+	return nil
+}
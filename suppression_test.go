@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseSuppressionsErrors(t *testing.T) {
+	content := `https://a.example.com/ <!-- link-checker: ignore-line -->
+link-checker: ignore-end
+link-checker: ignore-start "a"
+link-checker: ignore-start "b"
+`
+	_, errs := parseSuppressions("README.md", []byte(content))
+	err := errors.Join(errs...)
+	for _, want := range []string{
+		`README.md:1: ignore-line requires a reason`,
+		`README.md:2: ignore-end without ignore-start`,
+		`README.md:4: ignore-start inside the block started at line 3`,
+		`README.md:3: ignore-start without ignore-end`,
+	} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("parseSuppressions() errors = %v, want to contain %q", err, want)
+		}
+	}
+
+	// Invalid suppressions are extraction errors, and the links are still checked
+	var httpHead HttpAccessor = func(req HttpRequest) (int, error) {
+		return 404, nil
+	}
+	readFile := getReadFileMock([]readFileEntry{{"README.md", content}})
+	f := &failures{}
+	f.addLinkErrors(checkFile(context.Background(), "README.md", 1, nil, newSeenURLs(), readFile, httpHead))
+	if f.counts[failureIO] != 4 || f.counts[failureDeadLink] != 1 {
+		t.Errorf("failures = %v, want 4 extraction/IO errors and 1 dead link", f)
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// triageItem is a failing URL, together with every place it is found.
+type triageItem struct {
+	Failure   *linkError
+	Locations []string
+}
+
+// triageDecision is what the user chose for a failure. At most one field is set; none means skipped.
+type triageDecision struct {
+	Ignore       *Ignore
+	PrefixIgnore *PrefixIgnore
+}
+
+// collectTriageItems groups failures by URL, with the locations of each URL taken from entries
+// (except those suppressed or skipped, where the URL is not checked).
+func collectTriageItems(failures []*linkError, entries []linkEntry) []triageItem {
+	items := []triageItem{}
+	for _, failure := range failures {
+		if slices.ContainsFunc(items, func(item triageItem) bool { return item.Failure.URL == failure.URL }) {
+			continue
+		}
+		item := triageItem{Failure: failure}
+		for _, entry := range entries {
+			if entry.URL == failure.URL && !entry.suppressed && !entry.skipped {
+				item.Locations = append(item.Locations, fmt.Sprintf("%s:%d", entry.File, entry.Line))
+			}
+		}
+		if len(item.Locations) == 0 {
+			item.Locations = []string{fmt.Sprintf("%s:%d", failure.Path, failure.Line)}
+		}
+		items = append(items, item)
+	}
+	return items
+}
+
+// prompter reads answers from in, writing questions to out.
+type prompter struct {
+	in  *bufio.Scanner
+	out io.Writer
+}
+
+// errQuit is returned by prompter when the user quits or the input ends.
+var errQuit = errors.New("quit")
+
+// ask writes question and returns the trimmed answer, or def if the answer is empty.
+func (p *prompter) ask(question string, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	if !p.in.Scan() {
+		if err := p.in.Err(); err != nil {
+			return "", err
+		}
+		fmt.Fprintln(p.out)
+		return "", errQuit
+	}
+	answer := strings.TrimSpace(p.in.Text())
+	if answer == "" {
+		return def, nil
+	}
+	return answer, nil
+}
+
+// askRequired asks question until a non-empty answer is given.
+func (p *prompter) askRequired(question string) (string, error) {
+	for {
+		answer, err := p.ask(question, "")
+		if err != nil || answer != "" {
+			return answer, err
+		}
+		fmt.Fprintf(p.out, "an answer is required\n")
+	}
+}
+
+// askList asks for items one per line until an empty line; at least one is required.
+func (p *prompter) askList(question string) ([]string, error) {
+	fmt.Fprintf(p.out, "%s (one per line, empty line to finish)\n", question)
+	answers := []string{}
+	for {
+		answer, err := p.ask("-", "")
+		if err != nil {
+			return nil, err
+		}
+		if answer == "" {
+			if len(answers) > 0 {
+				return answers, nil
+			}
+			fmt.Fprintf(p.out, "at least one is required\n")
+			continue
+		}
+		answers = append(answers, answer)
+	}
+}
+
+// triage walks the user through items, reading answers from in and writing prompts to out.
+// Decisions made before the user quits (or the input ends) are returned.
+func triage(in io.Reader, out io.Writer, items []triageItem) ([]triageDecision, error) {
+	p := &prompter{in: bufio.NewScanner(in), out: out}
+	decisions := []triageDecision{}
+	for i, item := range items {
+		decision, err := triageOne(p, i, len(items), item)
+		if errors.Is(err, errQuit) {
+			return decisions, nil
+		}
+		if err != nil {
+			return decisions, err
+		}
+		decisions = append(decisions, decision)
+	}
+	return decisions, nil
+}
+
+func triageOne(p *prompter, i int, n int, item triageItem) (triageDecision, error) {
+	failure := item.Failure
+	fmt.Fprintf(p.out, "\n[%d/%d] %s\n", i+1, n, failure.URL)
+	fmt.Fprintf(p.out, "error: %v\n", failure.Err)
+	fmt.Fprintf(p.out, "found in: %s\n", strings.Join(item.Locations, ", "))
+	for {
+		choice, err := p.ask("(i)gnore, (p)refix ignore, (s)kip, (q)uit", "s")
+		if err != nil {
+			return triageDecision{}, err
+		}
+		switch choice {
+		case "i":
+			ignore, err := askIgnore(p, failure)
+			return triageDecision{Ignore: ignore}, err
+		case "p":
+			prefixIgnore, err := askPrefixIgnore(p, failure.URL)
+			return triageDecision{PrefixIgnore: prefixIgnore}, err
+		case "s":
+			return triageDecision{}, nil
+		case "q":
+			return triageDecision{}, errQuit
+		}
+		fmt.Fprintf(p.out, "unknown choice: %s\n", choice)
+	}
+}
+
+// askIgnore asks for an exact ignore of failure. A failure without a status code accepts any request error.
+func askIgnore(p *prompter, failure *linkError) (*Ignore, error) {
+	ignore := &Ignore{URL: failure.URL}
+	var statusErr *statusCodeError
+	if errors.As(failure.Err, &statusErr) {
+		for {
+			answer, err := p.ask("accepted status codes, comma-separated", strconv.Itoa(statusErr.StatusCode))
+			if err != nil {
+				return nil, err
+			}
+			ignore.Codes, err = parseCodes(answer)
+			if err == nil {
+				break
+			}
+			fmt.Fprintf(p.out, "%v\n", err)
+		}
+	} else {
+		ignore.HasTLSError = true
+	}
+	var err error
+	if ignore.Reason, err = p.askRequired("reason"); err != nil {
+		return nil, err
+	}
+	if ignore.ConsideredAlternatives, err = p.askList("considered alternatives"); err != nil {
+		return nil, err
+	}
+	return ignore, nil
+}
+
+// askPrefixIgnore asks for a prefix ignore covering rawURL, proposing its scheme and host.
+func askPrefixIgnore(p *prompter, rawURL string) (*PrefixIgnore, error) {
+	def := rawURL
+	if u, err := url.Parse(rawURL); err == nil && u.Host != "" {
+		def = u.Scheme + "://" + u.Host + "/"
+	}
+	prefixIgnore := &PrefixIgnore{}
+	for {
+		prefix, err := p.ask("prefix", def)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(rawURL, prefix) {
+			prefixIgnore.Prefix = prefix
+			break
+		}
+		fmt.Fprintf(p.out, "%s is not a prefix of %s\n", prefix, rawURL)
+	}
+	var err error
+	if prefixIgnore.Reason, err = p.askRequired("reason"); err != nil {
+		return nil, err
+	}
+	return prefixIgnore, nil
+}
+
+// parseCodes parses comma-separated status codes.
+func parseCodes(s string) ([]int, error) {
+	codes := []int{}
+	for _, field := range strings.Split(s, ",") {
+		code, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || code < 100 || code > 599 {
+			return nil, fmt.Errorf("invalid status code: %q", strings.TrimSpace(field))
+		}
+		codes = append(codes, code)
+	}
+	return codes, nil
+}
+
+// writeTriageDecisions writes the ignores and prefix ignores in decisions as TOML, to be appended to the configuration file.
+func writeTriageDecisions(w io.Writer, decisions []triageDecision) {
+	first := true
+	for _, decision := range decisions {
+		if decision.Ignore == nil && decision.PrefixIgnore == nil {
+			continue
+		}
+		if !first {
+			fmt.Fprintln(w)
+		}
+		first = false
+		if decision.Ignore != nil {
+			writeIgnore(w, decision.Ignore)
+		} else {
+			writePrefixIgnore(w, decision.PrefixIgnore)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTriage(t *testing.T) {
+	items := collectTriageItems([]*linkError{
+		{Path: "README.md", Line: 2, URL: "https://example.com/gone", Err: &statusCodeError{StatusCode: 404}},
+		{Path: "main.go", Line: 1, URL: "https://down.example.com/a", Err: errors.New("connection refused")},
+		{Path: "README.md", Line: 3, URL: "https://example.com/moved", Err: &statusCodeError{StatusCode: 500}},
+		{Path: "README.md", Line: 4, URL: "https://example.com/locked", Err: &statusCodeError{StatusCode: 500}},
+	}, []linkEntry{
+		{File: "README.md", Line: 2, URL: "https://example.com/gone"},
+		{File: "docs/guide.md", Line: 7, URL: "https://example.com/gone"},
+		{File: "docs/old.md", Line: 1, URL: "https://example.com/gone", skipped: true},
+		{File: "docs/draft.md", Line: 5, URL: "https://example.com/gone", suppressed: true},
+	})
+	if got, want := items[0].Locations, []string{"README.md:2", "docs/guide.md:7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Locations = %v, want %v", got, want)
+	}
+
+	input := strings.Join([]string{
+		// ignore with the observed code, after an invalid choice and an empty reason
+		"x", "i", "", "", "removed upstream", "no archived copy", "",
+		// ignore of a request error
+		"i", "internal host", "", "public mirror", "",
+		// prefix ignore, after a prefix that does not match
+		"p", "https://other.example.com/", "", "rate limited",
+		// a removed choice
+		"l", "s",
+	}, "\n") + "\n"
+	var out strings.Builder
+	decisions, err := triage(strings.NewReader(input), &out, items)
+	if err != nil {
+		t.Fatalf("triage() error = %v, want nil", err)
+	}
+	want := []triageDecision{
+		{Ignore: &Ignore{URL: "https://example.com/gone", Codes: []int{404}, Reason: "removed upstream", ConsideredAlternatives: []string{"no archived copy"}}},
+		{Ignore: &Ignore{URL: "https://down.example.com/a", HasTLSError: true, Reason: "internal host", ConsideredAlternatives: []string{"public mirror"}}},
+		{PrefixIgnore: &PrefixIgnore{Prefix: "https://example.com/", Reason: "rate limited"}},
+		{},
+	}
+	if !reflect.DeepEqual(decisions, want) {
+		t.Errorf("triage() = %+v, want %+v", decisions, want)
+	}
+	for _, want := range []string{"unknown choice: x", "unknown choice: l", "an answer is required", "at least one is required", "is not a prefix of"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("output = %s, want to contain %q", out.String(), want)
+		}
+	}
+
+	// Decisions before the end of the input are kept
+	decisions, err = triage(strings.NewReader("s\n"), &out, items)
+	if err != nil || len(decisions) != 1 {
+		t.Errorf("triage() = %v, %v, want 1 decision", decisions, err)
+	}
+
+	// The entries are appended, keeping the existing text
+	original := "# shared settings\nretry_count = 1\ntext_file_extensions = [\".md\"]\n"
+	configPath := filepath.Join(t.TempDir(), "check_links_config.toml")
+	if err := os.WriteFile(configPath, []byte(original), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	var b strings.Builder
+	writeTriageDecisions(&b, want)
+	if err := appendToConfigFile(configPath, b.String()); err != nil {
+		t.Fatalf("appendToConfigFile() error = %v, want nil", err)
+	}
+	content, _ := os.ReadFile(configPath)
+	if !strings.HasPrefix(string(content), original) {
+		t.Errorf("config = %s, want to start with %q", content, original)
+	}
+	config, err := readConfig(configPath)
+	if err != nil {
+		t.Fatalf("readConfig() error = %v, want nil", err)
+	}
+	if len(config.Ignores) != 2 || len(config.PrefixIgnores) != 1 {
+		t.Errorf("Ignores = %v, PrefixIgnores = %v, want 2 and 1", config.Ignores, config.PrefixIgnores)
+	}
+
+	// An invalid result leaves the file as is
+	if err := appendToConfigFile(configPath, "[[ignores]]\nurl = \"https://example.com/\"\n"); err == nil {
+		t.Errorf("appendToConfigFile() error = nil, want an error")
+	}
+	if after, _ := os.ReadFile(configPath); string(after) != string(content) {
+		t.Errorf("config = %s, want %s", after, content)
+	}
+}
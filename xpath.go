@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// A subset of XPath for selecting elements: absolute location paths of element steps separated by / or //,
+// each a tag name or *, with predicates [N] (1-based position among the siblings with the same name), [@attr] and
+// [@attr='value'], e.g. //table[@id='registry']/tbody/tr[2]. It is evaluated on the tree parseHTML builds.
+
+type xpathPredicate struct {
+	// 1-based; 0 for an attribute predicate
+	position int
+	attr     string
+	hasValue bool
+	value    string
+}
+
+type xpathStep struct {
+	// whether the step is preceded by //
+	descendant bool
+	// "*" for any element
+	tag        string
+	predicates []xpathPredicate
+}
+
+type xpathSelector []xpathStep
+
+type xpathParser struct {
+	s string
+	i int
+}
+
+func (p *xpathParser) eof() bool {
+	return p.i >= len(p.s)
+}
+
+// ident reads a name; escapes are not supported.
+func (p *xpathParser) ident() string {
+	start := p.i
+	for !p.eof() {
+		c := p.s[p.i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c >= 0x80) {
+			break
+		}
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// parseXPath parses s, which must start with /.
+func parseXPath(s string) (xpathSelector, error) {
+	p := &xpathParser{s: s}
+	selector := xpathSelector{}
+	for !p.eof() {
+		var step xpathStep
+		switch {
+		case strings.HasPrefix(p.s[p.i:], "//"):
+			step.descendant = true
+			p.i += 2
+		case p.s[p.i] == '/':
+			p.i++
+		default:
+			return nil, fmt.Errorf("invalid XPath %q: expected '/' at %d", s, p.i)
+		}
+		if !p.eof() && p.s[p.i] == '*' {
+			step.tag = "*"
+			p.i++
+		} else if step.tag = strings.ToLower(p.ident()); step.tag == "" {
+			return nil, fmt.Errorf("invalid XPath %q: expected a tag name at %d", s, p.i)
+		}
+		for !p.eof() && p.s[p.i] == '[' {
+			p.i++
+			predicate, err := p.predicate()
+			if err != nil {
+				return nil, fmt.Errorf("invalid XPath %q: %w", s, err)
+			}
+			step.predicates = append(step.predicates, predicate)
+		}
+		selector = append(selector, step)
+	}
+	if len(selector) == 0 {
+		return nil, fmt.Errorf("invalid XPath %q: no steps", s)
+	}
+	return selector, nil
+}
+
+func (p *xpathParser) predicate() (xpathPredicate, error) {
+	var predicate xpathPredicate
+	start := p.i
+	for !p.eof() && '0' <= p.s[p.i] && p.s[p.i] <= '9' {
+		p.i++
+	}
+	if p.i > start {
+		predicate.position, _ = strconv.Atoi(p.s[start:p.i])
+		if predicate.position == 0 {
+			return predicate, fmt.Errorf("positions start at 1 (at %d)", start)
+		}
+	} else {
+		if p.eof() || p.s[p.i] != '@' {
+			return predicate, fmt.Errorf("expected a position or '@' at %d", p.i)
+		}
+		p.i++
+		if predicate.attr = strings.ToLower(p.ident()); predicate.attr == "" {
+			return predicate, fmt.Errorf("expected an attribute name at %d", p.i)
+		}
+		if !p.eof() && p.s[p.i] == '=' {
+			p.i++
+			if p.eof() || (p.s[p.i] != '"' && p.s[p.i] != '\'') {
+				return predicate, fmt.Errorf("expected a quoted value at %d", p.i)
+			}
+			end := strings.IndexByte(p.s[p.i+1:], p.s[p.i])
+			if end < 0 {
+				return predicate, fmt.Errorf("unterminated string at %d", p.i)
+			}
+			predicate.hasValue = true
+			predicate.value = p.s[p.i+1 : p.i+1+end]
+			p.i += end + 2
+		}
+	}
+	if p.eof() || p.s[p.i] != ']' {
+		return predicate, fmt.Errorf("expected ']' at %d", p.i)
+	}
+	p.i++
+	return predicate, nil
+}
+
+// selectNodes returns the elements selected by x from root, in document order.
+func (x xpathSelector) selectNodes(root *html.Node) []*html.Node {
+	nodes := []*html.Node{root}
+	for _, step := range x {
+		next := []*html.Node{}
+		seen := map[*html.Node]bool{}
+		for _, n := range nodes {
+			var candidates []*html.Node
+			if step.descendant {
+				candidates = descendants(n)
+			} else {
+				candidates = children(n)
+			}
+			for _, c := range candidates {
+				if !seen[c] && step.matches(c) {
+					seen[c] = true
+					next = append(next, c)
+				}
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+func (step xpathStep) matchesName(n *html.Node) bool {
+	return n.Type == html.ElementNode && (step.tag == "*" || step.tag == n.Data)
+}
+
+func (step xpathStep) matches(n *html.Node) bool {
+	if !step.matchesName(n) {
+		return false
+	}
+	for _, predicate := range step.predicates {
+		if predicate.position > 0 {
+			position := 0
+			for sibling := n.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+				if step.matchesName(sibling) {
+					position++
+				}
+				if sibling == n {
+					break
+				}
+			}
+			if position != predicate.position {
+				return false
+			}
+			continue
+		}
+		value, ok := attribute(n, predicate.attr)
+		if !ok || predicate.hasValue && value != predicate.value {
+			return false
+		}
+	}
+	return true
+}
+
+// children returns the children of n in document order.
+func children(n *html.Node) []*html.Node {
+	result := []*html.Node{}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		result = append(result, child)
+	}
+	return result
+}
+
+// descendants returns the descendants of n in document order.
+func descendants(n *html.Node) []*html.Node {
+	result := []*html.Node{}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		result = append(result, child)
+		result = append(result, descendants(child)...)
+	}
+	return result
+}